@@ -0,0 +1,357 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"mrshanahan.com/notes-term/internal/config"
+	"mrshanahan.com/notes-term/internal/keymap"
+	"mrshanahan.com/notes-term/internal/util"
+	w "mrshanahan.com/notes-term/internal/window"
+)
+
+// Action is a command in the interactive UI. Its keys can be changed in the
+// [keys] table of the config file.
+type Action struct {
+	Name string
+	// Shown in help; consecutive actions with the same description share a
+	// line
+	Description string
+	Keys        []string
+	Run         func(window *w.MainWindow)
+}
+
+var (
+	actions []*Action
+	keys    = keymap.New()
+	exiting = false
+)
+
+func init() {
+	actions = []*Action{
+		{"down", "Down/up", []string{"j", "down", "wheeldown"}, func(window *w.MainWindow) {
+			window.MoveSelection(1)
+		}},
+		{"up", "Down/up", []string{"k", "up", "wheelup"}, func(window *w.MainWindow) {
+			window.MoveSelection(-1)
+		}},
+		{"half_page_up", "Half page up/down", []string{"ctrl+u"}, func(window *w.MainWindow) {
+			window.SetSelection(window.Selection - util.Max(window.PageSize()/2, 1).Value)
+		}},
+		{"half_page_down", "Half page up/down", []string{"ctrl+d"}, func(window *w.MainWindow) {
+			window.SetSelection(window.Selection + util.Max(window.PageSize()/2, 1).Value)
+		}},
+		{"page_up", "Page up/down", []string{"pgup"}, func(window *w.MainWindow) {
+			window.SetSelection(window.Selection - window.PageSize())
+		}},
+		{"page_down", "Page up/down", []string{"pgdn"}, func(window *w.MainWindow) {
+			window.SetSelection(window.Selection + window.PageSize())
+		}},
+		{"first", "First/last note", []string{"g", "home"}, func(window *w.MainWindow) {
+			window.SetSelection(0)
+		}},
+		{"last", "First/last note", []string{"G", "end"}, func(window *w.MainWindow) {
+			window.SetSelection(len(window.Rows) - 1)
+		}},
+		{"filter", "Filter notes", []string{"/"}, func(window *w.MainWindow) {
+			window.RequestFilter()
+		}},
+		{"clear_filter", "Clear filter", []string{"esc"}, func(window *w.MainWindow) {
+			window.SetFilter("")
+		}},
+		{"create", "Create note", []string{"ctrl+n"}, createNote},
+		{"rename", "Rename note", []string{"ctrl+r"}, renameNote},
+		{"delete", "Delete note", []string{"d"}, deleteNote},
+		{"import", "Import note", []string{"ctrl+i"}, importNote},
+		{"search", "Search contents", []string{"ctrl+f"}, searchContents},
+		{"edit", "Edit note", []string{"enter"}, func(window *w.MainWindow) {
+			if note := window.SelectedNote(); note != nil {
+				editNote(window, note, 0)
+			}
+		}},
+		{"toggle_preview", "Toggle preview", []string{"p"}, func(window *w.MainWindow) {
+			window.ShowPreview = !window.ShowPreview
+			window.Resize(window.Width, window.Height)
+		}},
+		{"preview_down", "Scroll preview", []string{"J"}, func(window *w.MainWindow) {
+			window.Preview.Scroll(1)
+		}},
+		{"preview_up", "Scroll preview", []string{"K"}, func(window *w.MainWindow) {
+			window.Preview.Scroll(-1)
+		}},
+		{"preview_page_up", "Page preview", []string{"{"}, func(window *w.MainWindow) {
+			window.Preview.Scroll(-window.Preview.PageSize())
+		}},
+		{"preview_page_down", "Page preview", []string{"}"}, func(window *w.MainWindow) {
+			window.Preview.Scroll(window.Preview.PageSize())
+		}},
+		{"toggle_markdown", "Toggle Markdown", []string{"m"}, func(window *w.MainWindow) {
+			window.Preview.ToggleMarkdown()
+		}},
+		{"reload_preview", "Reload preview", []string{"r"}, func(window *w.MainWindow) {
+			if note := window.SelectedNote(); note != nil {
+				contentCache.Invalidate(note.ID)
+			}
+			window.Preview.Reload()
+		}},
+		{"switch_profile", "Switch profile", []string{"P"}, chooseProfile},
+		{"help", "Toggle help", []string{"ctrl+h"}, func(window *w.MainWindow) {
+			window.HelpCollapsed = !window.HelpCollapsed
+		}},
+		{"quit", "Exit", []string{"q", "ctrl+c"}, func(window *w.MainWindow) {
+			exiting = window.RequestConfirmation("Are you sure you want to leave?")
+		}},
+	}
+}
+
+func findAction(name string) *Action {
+	for _, a := range actions {
+		if a.Name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// actionKeys returns the keys for an action, from c's [keys] if set there.
+func actionKeys(c *config.Config, a *Action) []string {
+	configured, ok := c.Keys[a.Name]
+	if !ok {
+		return a.Keys
+	}
+	specs := []string{}
+	for _, k := range configured {
+		specs = append(specs, string(k))
+	}
+	return specs
+}
+
+// newKeymap binds the keys for every action, checking that c's [keys] only
+// names actions that exist & doesn't bind conflicting keys.
+func newKeymap(c *config.Config) (*keymap.Keymap, error) {
+	names := []string{}
+	for name := range c.Keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if findAction(name) == nil {
+			return nil, keysError(c, name, fmt.Errorf("unknown action '%s' in [keys]", name))
+		}
+	}
+	km := keymap.New()
+	for _, a := range actions {
+		for _, spec := range actionKeys(c, a) {
+			err := km.Bind(spec, a.Name)
+			var conflict *keymap.ConflictError
+			if errors.As(err, &conflict) {
+				// Only one of the two can be the default
+				if _, ok := c.Keys[a.Name]; !ok {
+					return nil, keysError(c, conflict.OtherCommand, err)
+				}
+				return nil, keysError(c, a.Name, err)
+			} else if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return km, nil
+}
+
+// keysError returns err about the keys of action in c's [keys], placed at
+// the line of the config file they're set on.
+func keysError(c *config.Config, action string, err error) error {
+	return configFile.Errorf(c.Profile, []string{"keys", action}, "%w", err)
+}
+
+// helpText lists the keys for each action, e.g. "q/CTRL+C Exit", sharing a
+// line between consecutive actions with the same description.
+func helpText(c *config.Config) []string {
+	labels, descriptions := []string{}, []string{}
+	for _, a := range actions {
+		specs := []string{}
+		for _, spec := range actionKeys(c, a) {
+			// The wheel goes without saying
+			if !keymap.Mouse(spec) {
+				specs = append(specs, keymap.Label(spec))
+			}
+		}
+		if len(specs) == 0 {
+			continue
+		}
+		label := strings.Join(specs, "/")
+		if n := len(descriptions); n > 0 && descriptions[n-1] == a.Description {
+			labels[n-1] += "/" + label
+		} else {
+			labels = append(labels, label)
+			descriptions = append(descriptions, a.Description)
+		}
+	}
+
+	width := w.StringWidth(util.MaxBy(labels, func(l string) int { return w.StringWidth(l) }).Value)
+	lines := make([]string, len(labels))
+	for i := range labels {
+		lines[i] = w.Pad(labels[i], width) + " " + descriptions[i]
+	}
+	return lines
+}
+
+// How far the wheel scrolls the preview per step
+const WHEEL_PREVIEW_LINES = 3
+
+// handleKey runs the action bound to key in the main window, or handles it
+// as a mouse key (see handleMouse).
+func handleKey(window *w.MainWindow, key w.Key) {
+	if key.Mouse() {
+		row, col := w.MousePosition()
+		handleMouse(window, key, row, col)
+	} else if name, _ := keys.Feed(key); name != "" {
+		findAction(name).Run(window)
+	}
+}
+
+// handleMouse handles a mouse key at the screen position (row, col) in the
+// main window: clicking a note selects it & double-clicking opens it. The
+// wheel scrolls the preview when over it & otherwise goes through the keymap
+// like any other key.
+func handleMouse(window *w.MainWindow, key w.Key, row, col int) {
+	switch key.Code {
+	case w.KEY_CLICK, w.KEY_DOUBLE_CLICK:
+		idx := window.RowAt(row, col)
+		if idx < 0 {
+			return
+		}
+		window.SetSelection(idx)
+		if key.Code == w.KEY_DOUBLE_CLICK {
+			findAction("edit").Run(window)
+		}
+	case w.KEY_WHEEL_UP, w.KEY_WHEEL_DOWN:
+		if window.PreviewVisible() && window.Preview.Contains(row, col) {
+			if key.Code == w.KEY_WHEEL_UP {
+				window.Preview.Scroll(-WHEEL_PREVIEW_LINES)
+			} else {
+				window.Preview.Scroll(WHEEL_PREVIEW_LINES)
+			}
+		} else if name, _ := keys.Feed(key); name != "" {
+			findAction(name).Run(window)
+		}
+	}
+}
+
+func createNote(window *w.MainWindow) {
+	values := window.RequestInput("Create note", []string{"Title"})
+	if values == nil {
+		return
+	}
+	// TODO: Make all of these asynchronous
+	newNote, err := client.CreateNote(values["Title"])
+	if err != nil {
+		window.ShowErrorBox(err)
+	} else {
+		window.Notes = append(window.Notes, newNote)
+		window.NotesChanged()
+	}
+}
+
+func renameNote(window *w.MainWindow) {
+	noteIdx := window.SelectedIndex()
+	if noteIdx < 0 {
+		return
+	}
+	values := window.RequestInputWithDefaults("Rename note", map[string]string{"Title": window.Notes[noteIdx].Title})
+	if values == nil {
+		return
+	}
+	note := window.Notes[noteIdx]
+	// TODO: Make all of these asynchronous
+	err := client.UpdateNote(note.ID, values["Title"])
+	if err != nil {
+		window.ShowErrorBox(err)
+		return
+	}
+	updatedNote, err := client.GetNote(note.ID)
+	if err != nil {
+		window.ShowErrorBox(err)
+		window.Notes[noteIdx].Title = values["Title"]
+	} else {
+		window.Notes[noteIdx] = updatedNote
+	}
+	window.NotesChanged()
+}
+
+func deleteNote(window *w.MainWindow) {
+	noteIdx := window.SelectedIndex()
+	if noteIdx < 0 {
+		return
+	}
+	showtitle := w.Truncate(window.Notes[noteIdx].Title, 20)
+	confirmmsg := fmt.Sprintf("Delete note '%s'?", showtitle)
+	if !window.RequestConfirmation(confirmmsg) {
+		return
+	}
+	err := client.DeleteNote(window.Notes[noteIdx].ID)
+	if err != nil {
+		// TODO: Title describing failed action
+		window.ShowErrorBox(err)
+	} else {
+		contentCache.Invalidate(window.Notes[noteIdx].ID)
+		window.Notes = append(window.Notes[:noteIdx], window.Notes[noteIdx+1:]...)
+	}
+}
+
+func importNote(window *w.MainWindow) {
+	values := window.RequestInput("Enter path to existing note", []string{"Path"})
+	if values == nil {
+		return
+	}
+	path := values["Path"]
+	_, defaultTitle := filepath.Split(path)
+	values = window.RequestInputWithDefaults("New name", map[string]string{"Title": defaultTitle})
+	if values == nil {
+		return
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		window.ShowErrorBox(err)
+		return
+	}
+	note, err := client.CreateNote(values["Title"])
+	if err != nil {
+		window.ShowErrorBox(err)
+		return
+	}
+	err = client.UpdateNoteContent(note.ID, content)
+	if err != nil {
+		window.ShowErrorBox(fmt.Errorf("error while setting content; cleaning up: %w", err))
+		err := client.DeleteNote(note.ID)
+		if err != nil {
+			window.ShowErrorBox(fmt.Errorf("error while cleaning up; manually update content for note %d: %w", note.ID, err))
+		}
+	} else {
+		window.Notes = append(window.Notes, note)
+		window.NotesChanged()
+	}
+}
+
+func chooseProfile(window *w.MainWindow) {
+	names := configFile.ProfileNames()
+	if len(names) < 2 {
+		window.ShowInfoBox("No other profiles are configured.")
+		return
+	}
+	choice := window.RequestOptionSelection(fmt.Sprintf("Switch profile (current: %s)", cfg.Profile), names)
+	if choice < 0 || names[choice] == cfg.Profile {
+		return
+	}
+	window.Draw()
+	if err := switchProfile(window, names[choice]); err != nil {
+		window.Draw()
+		window.ShowErrorBox(fmt.Errorf("could not switch to profile '%s': %w", names[choice], err))
+	} else {
+		window.Profile = cfg.Profile
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mrshanahan/notes-api/pkg/notes"
+	"mrshanahan.com/notes-term/internal/config"
+	w "mrshanahan.com/notes-term/internal/window"
+)
+
+const (
+	TEST_TERM_WIDTH  = 120
+	TEST_TERM_HEIGHT = 30
+	TEST_NOTES       = 100
+)
+
+// fixedSource serves the same long content for every note: 100 paragraphs.
+type fixedSource struct{}
+
+func (fixedSource) Lookup(note *notes.Note) ([]byte, bool) {
+	return []byte(strings.Repeat("line\n\n", 100)), true
+}
+
+func (s fixedSource) Get(note *notes.Note) ([]byte, error) {
+	content, _ := s.Lookup(note)
+	return content, nil
+}
+
+// newTestWindow returns a main window showing n notes & a preview, with the
+// default keys bound.
+func newTestWindow(t *testing.T, n int) *w.MainWindow {
+	t.Helper()
+	km, err := newKeymap(&config.Config{})
+	if err != nil {
+		t.Fatalf("newKeymap() returned error: %v", err)
+	}
+	prev := keys
+	t.Cleanup(func() { keys = prev })
+	keys = km
+
+	ns := []*notes.Note{}
+	for i := 0; i < n; i++ {
+		ns = append(ns, &notes.Note{ID: int64(i + 1), Title: fmt.Sprintf("note %d", i+1)})
+	}
+	window := w.NewMainWindow(TEST_TERM_WIDTH, TEST_TERM_HEIGHT, ns)
+	window.SetHelpText(helpText(&config.Config{}), "CTRL+H")
+	window.EnablePreview(fixedSource{})
+	window.Preview.Update(window.SelectedNote())
+	return window
+}
+
+func TestNavigation(t *testing.T) {
+	page := newTestWindow(t, TEST_NOTES).PageSize()
+	last := TEST_NOTES - 1
+	tests := []struct {
+		name   string
+		start  int
+		keys   []w.Key
+		want   int
+		scroll int
+	}{
+		{"down", 0, []w.Key{w.Char('j')}, 1, 0},
+		{"down arrow", 0, []w.Key{{Code: w.KEY_DOWN}}, 1, 0},
+		{"up", 5, []w.Key{w.Char('k')}, 4, 0},
+		{"down past the end goes round", last, []w.Key{w.Char('j')}, 0, 0},
+		{"up past the start goes round", 0, []w.Key{{Code: w.KEY_UP}}, last, TEST_NOTES - page},
+		{"down scrolls", page - 1, []w.Key{w.Char('j')}, page, 1},
+		{"half page down", 0, []w.Key{w.Ctrl('d')}, page / 2, 0},
+		{"half page up", page, []w.Key{w.Ctrl('u')}, page - page/2, 1},
+		{"half page up at the start", 1, []w.Key{w.Ctrl('u')}, 0, 0},
+		{"page down", 0, []w.Key{{Code: w.KEY_PGDN}}, page, 1},
+		{"page down at the end", last - 1, []w.Key{{Code: w.KEY_PGDN}}, last, TEST_NOTES - page},
+		{"page up", page * 2, []w.Key{{Code: w.KEY_PGUP}}, page, page},
+		{"page up at the start", 1, []w.Key{{Code: w.KEY_PGUP}}, 0, 0},
+		{"last", 0, []w.Key{w.Char('G')}, last, TEST_NOTES - page},
+		{"end", 0, []w.Key{{Code: w.KEY_END}}, last, TEST_NOTES - page},
+		{"first", last, []w.Key{w.Char('g')}, 0, 0},
+		{"home", last, []w.Key{{Code: w.KEY_HOME}}, 0, 0},
+		{"several", 0, []w.Key{w.Char('j'), w.Char('j'), w.Char('k'), {Code: w.KEY_PGDN}}, page + 1, 2},
+		{"unbound", 3, []w.Key{w.Char('x')}, 3, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			window := newTestWindow(t, TEST_NOTES)
+			window.SetSelection(test.start)
+			for _, key := range test.keys {
+				handleKey(window, key)
+			}
+			if window.Selection != test.want || window.ScrollOffset != test.scroll {
+				t.Errorf("selection %d, scrolled to %d; want %d, %d", window.Selection, window.ScrollOffset, test.want, test.scroll)
+			}
+		})
+	}
+}
+
+func TestNavigationWithoutWrapping(t *testing.T) {
+	window := newTestWindow(t, TEST_NOTES)
+	window.WrapSelection = false
+	handleKey(window, w.Char('k'))
+	if window.Selection != 0 {
+		t.Errorf("up from the first note selected %d, want 0", window.Selection)
+	}
+	window.SetSelection(TEST_NOTES - 1)
+	handleKey(window, w.Char('j'))
+	if window.Selection != TEST_NOTES-1 {
+		t.Errorf("down from the last note selected %d, want %d", window.Selection, TEST_NOTES-1)
+	}
+}
+
+func TestNavigationWithoutNotes(t *testing.T) {
+	window := newTestWindow(t, 0)
+	for _, key := range []w.Key{w.Char('j'), w.Char('k'), w.Ctrl('d'), {Code: w.KEY_PGUP}, w.Char('G'), w.Char('g')} {
+		handleKey(window, key)
+		if window.Selection != 0 || window.ScrollOffset != 0 || window.SelectedNote() != nil {
+			t.Errorf("after %v: selection %d, scrolled to %d", key, window.Selection, window.ScrollOffset)
+		}
+	}
+}
+
+func TestHandleMouse(t *testing.T) {
+	layout := newTestWindow(t, TEST_NOTES)
+	page := layout.PageSize()
+	listRow, _ := layout.GetListBounds()
+	listCol, _ := layout.GetListColumns()
+	previewRow, _, previewCol, _ := layout.Preview.GetTextBounds()
+	// Below the last of a few notes
+	belowRow := listRow + 5
+	// Scrolled so the first row shows the note at page
+	scrolled := func(window *w.MainWindow) {
+		window.SetSelection(page*2 - 1)
+	}
+
+	tests := []struct {
+		name     string
+		setup    func(window *w.MainWindow)
+		notes    int
+		key      w.Key
+		row, col int
+		want     int
+		// How far the preview is scrolled afterwards
+		preview int
+		edited  bool
+	}{
+		{"click", nil, TEST_NOTES, w.Key{Code: w.KEY_CLICK}, listRow + 3, listCol, 3, 0, false},
+		{"click on the last visible row", nil, TEST_NOTES, w.Key{Code: w.KEY_CLICK}, listRow + page - 1, listCol + 5, page - 1, 0, false},
+		{"click when scrolled", scrolled, TEST_NOTES, w.Key{Code: w.KEY_CLICK}, listRow, listCol, page, 0, false},
+		{"click below the notes", nil, 3, w.Key{Code: w.KEY_CLICK}, belowRow, listCol, 0, 0, false},
+		{"click above the list", nil, TEST_NOTES, w.Key{Code: w.KEY_CLICK}, listRow - 1, listCol, 0, 0, false},
+		{"click on the preview", nil, TEST_NOTES, w.Key{Code: w.KEY_CLICK}, previewRow + 1, previewCol + 1, 0, 0, false},
+		{"shift+click", nil, TEST_NOTES, w.Key{Code: w.KEY_CLICK, Mod: w.MOD_SHIFT}, listRow + 2, listCol, 2, 0, false},
+		{"double click", nil, TEST_NOTES, w.Key{Code: w.KEY_DOUBLE_CLICK}, listRow + 4, listCol, 4, 0, true},
+		{"double click below the notes", nil, 3, w.Key{Code: w.KEY_DOUBLE_CLICK}, belowRow, listCol, 0, 0, false},
+		{"wheel down over the list", nil, TEST_NOTES, w.Key{Code: w.KEY_WHEEL_DOWN}, listRow, listCol, 1, 0, false},
+		{"wheel up over the list", scrolled, TEST_NOTES, w.Key{Code: w.KEY_WHEEL_UP}, listRow, listCol, page*2 - 2, 0, false},
+		{"wheel down over the preview", nil, TEST_NOTES, w.Key{Code: w.KEY_WHEEL_DOWN}, previewRow + 1, previewCol + 1, 0, WHEEL_PREVIEW_LINES, false},
+		{"wheel up over the preview", func(window *w.MainWindow) {
+			window.Preview.Scroll(10)
+		}, TEST_NOTES, w.Key{Code: w.KEY_WHEEL_UP}, previewRow + 1, previewCol + 1, 0, 10 - WHEEL_PREVIEW_LINES, false},
+		{"wheel up over the top of the preview", nil, TEST_NOTES, w.Key{Code: w.KEY_WHEEL_UP}, previewRow, previewCol, 0, 0, false},
+		{"wheel over the hidden preview", func(window *w.MainWindow) {
+			window.ShowPreview = false
+		}, TEST_NOTES, w.Key{Code: w.KEY_WHEEL_DOWN}, previewRow + 1, previewCol + 1, 1, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			window := newTestWindow(t, test.notes)
+			edit := findAction("edit")
+			prevRun := edit.Run
+			t.Cleanup(func() { edit.Run = prevRun })
+			edited := false
+			edit.Run = func(window *w.MainWindow) { edited = true }
+			if test.setup != nil {
+				test.setup(window)
+			}
+
+			handleMouse(window, test.key, test.row, test.col)
+			if window.Selection != test.want {
+				t.Errorf("selection %d, want %d", window.Selection, test.want)
+			}
+			if window.Preview.ScrollOffset != test.preview {
+				t.Errorf("preview scrolled to %d, want %d", window.Preview.ScrollOffset, test.preview)
+			}
+			if edited != test.edited {
+				t.Errorf("note opened: %v, want %v", edited, test.edited)
+			}
+		})
+	}
+}
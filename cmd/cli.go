@@ -0,0 +1,563 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/BurntSushi/toml"
+	"github.com/mrshanahan/notes-api/pkg/notes"
+	term "golang.org/x/term"
+	"mrshanahan.com/notes-term/internal/auth"
+	"mrshanahan.com/notes-term/internal/config"
+	"mrshanahan.com/notes-term/internal/workflow"
+)
+
+const (
+	EXIT_OK    = 0
+	EXIT_ERROR = 1
+	EXIT_USAGE = 2
+)
+
+// Command is a non-interactive subcommand, e.g. `notes ls`.
+type Command struct {
+	Name        string
+	Usage       string
+	Description string
+	Run         func(args []string) error
+}
+
+// usageError marks errors caused by bad arguments, which exit with EXIT_USAGE.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func newUsageError(format string, args ...any) error {
+	return &usageError{fmt.Sprintf(format, args...)}
+}
+
+var commands []*Command
+
+func init() {
+	commands = []*Command{
+		{"ls", "ls [--json]", "List notes", runList},
+		{"cat", "cat <id|title>", "Print the content of a note", runCat},
+		{"new", "new <title> [-|--from <file>]", "Create a note, optionally with content from a file or stdin", runNew},
+		{"rm", "rm <id|title> [--yes]", "Delete a note", runRemove},
+		{"rename", "rename <id|title> <new title>", "Rename a note", runRename},
+		{"append", "append <id|title> [--timestamp]", "Append stdin to the end of a note", runAppend},
+		{"edit", "edit <id|title> [--line <n>]", "Edit a note in your editor & upload the result", runEdit},
+		{"login", "login [--browser]", "Log in again with the device flow (or the browser), replacing any saved login", runLogin},
+		{"logout", "logout", "Revoke & remove the saved login", runLogout},
+		{"whoami", "whoami", "Show who you are logged in as", runWhoAmI},
+		{"config", "config check", "Check the config file & print the effective settings", runConfig},
+	}
+}
+
+func findCommand(name string) *Command {
+	for _, c := range commands {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func printUsage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: notes [flags] [command]\n\n")
+	fmt.Fprintf(out, "With no command, starts the interactive terminal UI.\n\n")
+	fmt.Fprintf(out, "Commands:\n")
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.Usage, c.Description)
+	}
+	tw.Flush()
+	fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// runCommand runs the subcommand named by args[0] & returns the process exit
+// code.
+func runCommand(args []string) int {
+	if args[0] == "help" {
+		printUsage()
+		return EXIT_OK
+	}
+
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "notes: unknown command '%s'\n\n", args[0])
+		printUsage()
+		return EXIT_USAGE
+	}
+
+	err := cmd.Run(args[1:])
+	var usageErr *usageError
+	if errors.As(err, &usageErr) {
+		fmt.Fprintf(os.Stderr, "notes %s: %s\nusage: notes %s\n", cmd.Name, err, cmd.Usage)
+		return EXIT_USAGE
+	} else if errors.Is(err, flag.ErrHelp) {
+		fmt.Printf("usage: notes %s\n", cmd.Usage)
+		return EXIT_OK
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "notes %s: error: %s\n", cmd.Name, err)
+		return EXIT_ERROR
+	}
+	return EXIT_OK
+}
+
+// parseArgs parses flags & positional arguments in any order, returning the
+// positional ones.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	fs.SetOutput(io.Discard)
+	positional := []string{}
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, newUsageError("%s", err)
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// resolveNote finds a note by numeric ID or, failing that, by exact title
+// (case-insensitively if there is no exact match).
+func resolveNote(ref string) (*notes.Note, error) {
+	ns, err := client.ListNotes()
+	if err != nil {
+		return nil, err
+	}
+
+	if id, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		for _, n := range ns {
+			if n.ID == id {
+				return n, nil
+			}
+		}
+	}
+
+	for _, matchFold := range []bool{false, true} {
+		matches := []*notes.Note{}
+		for _, n := range ns {
+			if n.Title == ref || (matchFold && strings.EqualFold(n.Title, ref)) {
+				matches = append(matches, n)
+			}
+		}
+		if len(matches) == 1 {
+			return matches[0], nil
+		} else if len(matches) > 1 {
+			ids := []string{}
+			for _, m := range matches {
+				ids = append(ids, strconv.FormatInt(m.ID, 10))
+			}
+			return nil, fmt.Errorf("'%s' matches %d notes (IDs: %s); use an ID instead", ref, len(matches), strings.Join(ids, ", "))
+		}
+	}
+	return nil, fmt.Errorf("no note found with ID or title '%s'", ref)
+}
+
+// confirm asks a yes/no question on stderr & reads the answer from stdin.
+// Refuses (returns an error) if stdin is not a terminal.
+func confirm(prompt string) (bool, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false, errors.New("stdin is not a terminal; pass --yes to confirm")
+	}
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", prompt)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+func runList(args []string) error {
+	fs := flag.NewFlagSet("ls", flag.ContinueOnError)
+	jsonFlag := fs.Bool("json", false, "Output notes as JSON")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return newUsageError("unexpected arguments: %s", strings.Join(positional, " "))
+	}
+
+	if err := initClient(); err != nil {
+		return err
+	}
+	ns, err := client.ListNotes()
+	if err != nil {
+		return err
+	}
+	sortNotes(ns)
+
+	if *jsonFlag {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(ns)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "ID\tUPDATED\tTITLE\n")
+	for _, n := range ns {
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", n.ID, n.UpdatedOn.Local().Format("2006-01-02 15:04"), n.Title)
+	}
+	return tw.Flush()
+}
+
+func runCat(args []string) error {
+	fs := flag.NewFlagSet("cat", flag.ContinueOnError)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return newUsageError("expected exactly one note")
+	}
+
+	if err := initClient(); err != nil {
+		return err
+	}
+	note, err := resolveNote(positional[0])
+	if err != nil {
+		return err
+	}
+	content, err := client.GetNoteContent(note.ID)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(content)
+	return err
+}
+
+func runNew(args []string) error {
+	fs := flag.NewFlagSet("new", flag.ContinueOnError)
+	fromFlag := fs.String("from", "", "Read initial content from this file ('-' for stdin)")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 2 && positional[1] == "-" {
+		if *fromFlag != "" {
+			return newUsageError("cannot use both - and --from")
+		}
+		*fromFlag = "-"
+		positional = positional[:1]
+	}
+	if len(positional) != 1 {
+		return newUsageError("expected exactly one title")
+	}
+	title := positional[0]
+	if strings.TrimSpace(title) == "" {
+		return newUsageError("title must not be empty")
+	}
+
+	var content []byte
+	if *fromFlag == "-" {
+		content, err = io.ReadAll(os.Stdin)
+	} else if *fromFlag != "" {
+		content, err = os.ReadFile(*fromFlag)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := initClient(); err != nil {
+		return err
+	}
+	note, err := client.CreateNote(title)
+	if err != nil {
+		return err
+	}
+	if content != nil {
+		err = client.UpdateNoteContent(note.ID, content)
+		if err != nil {
+			if delErr := client.DeleteNote(note.ID); delErr != nil {
+				return fmt.Errorf("error while setting content (%w); error while cleaning up, manually update content for note %d: %w", err, note.ID, delErr)
+			}
+			return fmt.Errorf("error while setting content; note was not created: %w", err)
+		}
+	}
+
+	fmt.Println(note.ID)
+	return nil
+}
+
+func runRemove(args []string) error {
+	fs := flag.NewFlagSet("rm", flag.ContinueOnError)
+	yesFlag := fs.Bool("yes", false, "Delete without asking for confirmation")
+	fs.BoolVar(yesFlag, "y", false, "Shorthand for --yes")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return newUsageError("expected exactly one note")
+	}
+
+	if err := initClient(); err != nil {
+		return err
+	}
+	note, err := resolveNote(positional[0])
+	if err != nil {
+		return err
+	}
+
+	if !*yesFlag {
+		yes, err := confirm(fmt.Sprintf("Delete note %d '%s'?", note.ID, note.Title))
+		if err != nil {
+			return err
+		}
+		if !yes {
+			return errors.New("not confirmed; nothing deleted")
+		}
+	}
+	return client.DeleteNote(note.ID)
+}
+
+func runRename(args []string) error {
+	fs := flag.NewFlagSet("rename", flag.ContinueOnError)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return newUsageError("expected a note & a new title")
+	}
+	if strings.TrimSpace(positional[1]) == "" {
+		return newUsageError("title must not be empty")
+	}
+
+	if err := initClient(); err != nil {
+		return err
+	}
+	note, err := resolveNote(positional[0])
+	if err != nil {
+		return err
+	}
+	return client.UpdateNote(note.ID, positional[1])
+}
+
+func runAppend(args []string) error {
+	fs := flag.NewFlagSet("append", flag.ContinueOnError)
+	timestampFlag := fs.Bool("timestamp", false, "Separate the new text with a line holding the current time")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return newUsageError("expected exactly one note")
+	}
+
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return errors.New("nothing to append; stdin was empty")
+	}
+
+	if err := initClient(); err != nil {
+		return err
+	}
+	note, err := resolveNote(positional[0])
+	if err != nil {
+		return err
+	}
+	return workflow.Append(client, note, data, workflow.AppendOptions{Timestamp: *timestampFlag})
+}
+
+func runEdit(args []string) error {
+	fs := flag.NewFlagSet("edit", flag.ContinueOnError)
+	lineFlag := fs.Int("line", 0, "Open the editor at this line")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return newUsageError("expected exactly one note")
+	}
+	if *lineFlag < 0 {
+		return newUsageError("line must not be negative")
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return errors.New("stdin is not a terminal; an interactive editor is required")
+	}
+
+	if err := initClient(); err != nil {
+		return err
+	}
+	note, err := resolveNote(positional[0])
+	if err != nil {
+		return err
+	}
+	ne, err := newNoteEditor(workflow.NewConsolePrompter(os.Stdin, os.Stderr))
+	if err != nil {
+		return err
+	}
+
+	result, err := ne.Edit(note, *lineFlag)
+	if err != nil {
+		return err
+	}
+	if result.Message != "" {
+		fmt.Fprintln(os.Stderr, result.Message)
+	}
+	if result.Cancelled {
+		return errors.New("edit cancelled")
+	}
+	return nil
+}
+
+// noArgs parses args for commands that take no arguments.
+func noArgs(name string, args []string) error {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return newUsageError("unexpected arguments: %s", strings.Join(positional, " "))
+	}
+	return nil
+}
+
+func runLogin(args []string) error {
+	fs := flag.NewFlagSet("login", flag.ContinueOnError)
+	browserFlag := fs.Bool("browser", false, "Log in through the browser instead of with the device flow")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return newUsageError("unexpected arguments: %s", strings.Join(positional, " "))
+	}
+
+	if err := auth.InitializeAuth(cfg); err != nil {
+		return err
+	}
+	// Unlike logins started by other commands, this ignores login_flow
+	flow := config.LOGIN_FLOW_DEVICE
+	if *browserFlag {
+		flow = config.LOGIN_FLOW_BROWSER
+	}
+	if _, err := auth.InteractiveLogin(context.Background(), flow, os.Stderr); err != nil {
+		return err
+	}
+	identity, err := auth.WhoAmI(context.Background())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Logged in as %s\n", identity.Username)
+	return nil
+}
+
+func runLogout(args []string) error {
+	if err := noArgs("logout", args); err != nil {
+		return err
+	}
+
+	if err := auth.InitializeAuth(cfg); err != nil {
+		return err
+	}
+	err := auth.Logout(context.Background())
+	// Cached note contents shouldn't outlast the login that fetched them
+	if dir := contentCacheDir(); dir != "" {
+		if removeErr := os.RemoveAll(dir); removeErr != nil && err == nil {
+			err = fmt.Errorf("could not remove cached notes: %w", removeErr)
+		}
+	}
+	return err
+}
+
+func runWhoAmI(args []string) error {
+	if err := noArgs("whoami", args); err != nil {
+		return err
+	}
+
+	if err := auth.InitializeAuth(cfg); err != nil {
+		return err
+	}
+	identity, err := auth.WhoAmI(context.Background())
+	if err != nil {
+		return err
+	}
+
+	user := identity.Username
+	if identity.Name != "" {
+		user = fmt.Sprintf("%s (%s)", user, identity.Name)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Profile:\t%s\n", cfg.Profile)
+	fmt.Fprintf(tw, "User:\t%s\n", user)
+	fmt.Fprintf(tw, "Email:\t%s\n", identity.Email)
+	fmt.Fprintf(tw, "Expires:\t%s\n", identity.Expiry.Local().Format("2006-01-02 15:04:05"))
+	return tw.Flush()
+}
+
+func runConfig(args []string) error {
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 || positional[0] != "check" {
+		return newUsageError("expected 'check'")
+	}
+
+	// The selected profile was already checked at startup & the settings of
+	// the rest when loading the file, but not their keys
+	for _, name := range configFile.ProfileNames() {
+		if name == cfg.Profile {
+			continue
+		}
+		other, err := configFile.Profile(name)
+		if err == nil {
+			err = validateConfig(other)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	status := ""
+	if _, err := os.Stat(configFile.Path); errors.Is(err, os.ErrNotExist) {
+		status = " (not found, using defaults)"
+	}
+	// Show every action's keys, not just the ones changed in the file
+	effective := map[string]config.KeyList{}
+	for _, a := range actions {
+		keys := config.KeyList{}
+		for _, spec := range actionKeys(cfg, a) {
+			keys = append(keys, config.Key(spec))
+		}
+		effective[a.Name] = keys
+	}
+	cfg.Keys = effective
+
+	fmt.Printf("# Config file: %s%s\n", configFile.Path, status)
+	fmt.Printf("# Profile: %s\n\n", cfg.Profile)
+	enc := toml.NewEncoder(os.Stdout)
+	enc.Indent = ""
+	return enc.Encode(cfg)
+}
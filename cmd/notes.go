@@ -1,14 +1,16 @@
 package main
 
 import (
-	"bytes"
-	"crypto/sha256"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"log"
+	"log/slog"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strings"
 
 	// "time"
 	// "strings"
@@ -17,141 +19,276 @@ import (
 	// termios "github.com/pkg/term/termios"
 	// unix "golang.org/x/sys/unix"
 
+	"mrshanahan.com/notes-term/internal/api"
 	"mrshanahan.com/notes-term/internal/auth"
+	"mrshanahan.com/notes-term/internal/config"
+	"mrshanahan.com/notes-term/internal/content"
+	"mrshanahan.com/notes-term/internal/editor"
 	"mrshanahan.com/notes-term/internal/paths"
 	w "mrshanahan.com/notes-term/internal/window"
+	"mrshanahan.com/notes-term/internal/workflow"
 
 	// "mrshanahan.com/notes-term/internal/notes"
 
-	nc "github.com/mrshanahan/notes-api/pkg/client"
-	// "github.com/mrshanahan/notes-api/pkg/notes"
+	"github.com/mrshanahan/notes-api/pkg/notes"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// Where log messages go while the UI is up, in the state folder
+	LOG_FILE = "notes.log"
+	// Where note contents are cached, in the profile's cache folder
+	CONTENT_CACHE_DIR = "content"
 )
 
 var (
-	client *nc.Client
+	client       *api.Client
+	tokens       *auth.TokenSource
+	configFile   *config.File
+	cfg          *config.Config
+	contentCache *content.Cache
 )
 
-func OpenEditor(path string) {
-	cmd := exec.Command("nvim", path)
-	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
-	err := cmd.Run()
+// newNoteEditor resolves the user's editor (see editor.Resolve) & sets up the
+// edit workflow, asking any questions through prompter.
+func newNoteEditor(prompter workflow.Prompter) (*workflow.NoteEditor, error) {
+	ed, err := editor.Resolve(cfg.Editor, cfg.EditorReadOnlyFlags)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	return &workflow.NoteEditor{Client: client, Editor: ed, Prompter: prompter, Cache: contentCache}, nil
 }
 
-type LocalCopyResult struct {
-	Path         string
-	IsCancelled  bool
-	OpenReadOnly bool
-}
+// editNote runs the full edit cycle for a note (see workflow.NoteEditor). If
+// line is positive the editor is opened at that line.
+func editNote(window *w.MainWindow, note *notes.Note, line int) {
+	defer w.HideCursor()
+	// Terminal editors would get mouse reports as typing
+	w.DisableMouse()
+	defer w.EnableMouse()
 
-func ensureDraftsRoot() (string, error) {
-	cacheDir, err := paths.EnsureLocalCacheFolder()
+	ne, err := newNoteEditor(window)
 	if err != nil {
-		return "", err
+		window.ShowErrorBox(err)
+		return
+	}
+	result, err := ne.Edit(note, line)
+	if err == nil && result.Note != nil {
+		for i, n := range window.Notes {
+			if n.ID == result.Note.ID {
+				window.Notes[i] = result.Note
+			}
+		}
+		window.NotesChanged()
 	}
-	draftDir := filepath.Join(cacheDir, "drafts")
-	if err = os.MkdirAll(draftDir, 0700); err != nil {
-		return "", err
+	window.Draw()
+	if err != nil {
+		window.ShowErrorBox(err)
+	} else if result.Message != "" {
+		window.ShowInfoBox(result.Message)
 	}
-	return draftDir, nil
 }
 
-func createLocalNoteCopy(window *w.MainWindow, remoteContent []byte) (*LocalCopyResult, error) {
-	draftsDir, err := ensureDraftsRoot()
-	if err != nil {
-		return nil, err
+// searchContents prompts for a query, searches the contents of every note &
+// opens the chosen result in the editor at the matching line.
+func searchContents(window *w.MainWindow) {
+	values := window.RequestInput("Search note contents", []string{"Query"})
+	if values == nil {
+		return
 	}
+	query := values["Query"]
 
-	// TODO: This is a bit long, maybe truncate
-	hash := getContentHash(remoteContent)
-	path := getDraftPath(draftsDir, hash)
+	window.DrawStatus(fmt.Sprintf("Searching %d notes...", len(window.Notes)))
+	result := content.Search(contentCache, window.Notes, query, content.DEFAULT_SEARCH_PARALLELISM)
+	if len(result.Errors) > 0 {
+		window.ShowErrorBox(fmt.Errorf("could not search %d note(s); results may be incomplete", len(result.Errors)))
+		window.Draw()
+	}
+	if len(result.Matches) == 0 {
+		window.ShowInfoBox(fmt.Sprintf("No notes contain '%s'.", query))
+		return
+	}
 
-	f, err := getIfExists(path)
+	results := make([]*w.SearchResult, len(result.Matches))
+	for i, m := range result.Matches {
+		results[i] = &w.SearchResult{Title: m.Note.Title, Line: m.Line, Text: m.Text, Start: m.Start, End: m.End}
+	}
+	title := fmt.Sprintf("Results for '%s'", query)
+	if result.Truncated {
+		title = fmt.Sprintf("First %d results for '%s'", len(results), query)
+	}
+	choice := window.RequestSearchResult(title, results)
+	if choice < 0 {
+		return
+	}
+	match := result.Matches[choice]
+	editNote(window, match.Note, match.Line)
+}
+
+func exitWithFatalError(err error) {
+	w.DisableMouse()
+	w.Move(0, 0)
+	w.ClearScreen()
+	fmt.Fprintf(os.Stderr, "error: %s\n", err) // TODO: fix weird % at end of line
+	os.Exit(-1)
+}
+
+// initClient logs in & sets up the API client & content cache.
+func initClient() error {
+	if err := auth.InitializeAuth(cfg); err != nil {
+		return err
+	}
+	loggedIn, err := auth.Login()
 	if err != nil {
-		return nil, err
+		return err
 	}
+	setClient(loggedIn, reauthenticate)
+	return nil
+}
 
-	if f != nil {
-		// TODO: Extract this out & make it available to main event loop
-		finfo, _ := f.Stat()
-		modtime := finfo.ModTime()
-		msg := fmt.Sprintf("An unsaved draft for this note was found locally. Continue editing? (Last edited: %s)", modtime)
-		selection := window.RequestOptionSelection(msg, []string{"Edit", "View (read-only)", "Discard", "Cancel"})
-		switch selection {
-		case 0: // Edit
-			return &LocalCopyResult{Path: path}, nil
-		case 1: // View (read-only)
-			return &LocalCopyResult{Path: path, OpenReadOnly: true}, nil
-		case 2: // Discard
-			err = os.Remove(path)
-			if err != nil {
-				return nil, err
-			}
-		case 3, -1: // Cancel
-			return &LocalCopyResult{IsCancelled: true}, nil
-		default:
-			return nil, fmt.Errorf("unexpected option choice for dealing with local copies: %d", selection)
-		}
+// setClient points the client & content cache at the active profile's
+// server, logged in with t.
+func setClient(t *auth.TokenSource, reauth func() error) {
+	tokens = t
+	client = api.NewClient(cfg.APIURL, tokens)
+	client.Reauthenticate = reauth
+	// Fetched in the background by the preview & content search, so must not
+	// prompt for a login
+	contentCache = content.NewCache(contentCacheDir(), client.Background().GetNoteContent)
+}
+
+// contentCacheDir returns the active profile's content cache folder, or "" to
+// cache only in memory if the cache folder can't be created.
+func contentCacheDir() string {
+	dir, err := paths.EnsureProfileCacheFolder()
+	if err != nil {
+		return ""
 	}
+	return filepath.Join(dir, CONTENT_CACHE_DIR)
+}
 
-	// NB: We should be here if 1) the file did not exist or 2) we discarded it.
+// reauthenticate logs in again (see auth.StartLogin) when the saved login can
+// no longer be refreshed.
+func reauthenticate() error {
+	fmt.Fprintln(os.Stderr, "> Your login has expired.")
+	token, err := auth.InteractiveLogin(context.Background(), cfg.LoginFlow, os.Stderr)
+	if err != nil {
+		return err
+	}
+	tokens.Set(token)
+	return nil
+}
 
-	// If file already exists we've done something wrong, so just
-	// we include O_EXCL here to fail fast
-	f, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0660)
+// reauthenticateInWindow is reauthenticate for when the TUI is up: the login
+// instructions are shown in a box instead of being printed.
+func reauthenticateInWindow(window *w.MainWindow) error {
+	token, err := loginInWindow(window, "Your login has expired.")
 	if err != nil {
-		return nil, err
+		return err
 	}
+	tokens.Set(token)
+	return nil
+}
 
-	defer f.Close()
+func loginInWindow(window *w.MainWindow, reason string) (*oauth2.Token, error) {
+	defer window.Draw()
 
-	r := bytes.NewReader(remoteContent)
-	_, err = io.Copy(f, r)
+	window.DrawStatus("Logging in...")
+	login, err := auth.StartLogin(context.Background())
 	if err != nil {
-		_ = os.Remove(path)
 		return nil, err
 	}
 
-	return &LocalCopyResult{Path: path}, nil
+	var token *oauth2.Token
+	lines := append([]string{reason, ""}, login.Instructions()...)
+	err = window.RunWithMessage(lines, func(ctx context.Context) (err error) {
+		token, err = login.Wait(ctx)
+		return
+	})
+	return token, err
 }
 
-func getContentHash(content []byte) string {
-	h := sha256.New()
-	h.Write(content)
-	return fmt.Sprintf("%x", h.Sum(nil))
-}
+// switchProfile logs in to another profile's server & shows its notes. If
+// anything fails, the current profile stays active.
+func switchProfile(window *w.MainWindow, name string) error {
+	newCfg, err := configFile.Profile(name)
+	if err != nil {
+		return err
+	}
+	if err = validateConfig(newCfg); err != nil {
+		return fmt.Errorf("invalid profile '%s': %w", name, err)
+	}
 
-func getDraftPath(root string, hash string) string {
-	name := fmt.Sprintf("note-%s.txt", hash)
-	path := filepath.Join(root, name)
-	return path
-}
+	prevCfg, prevTokens, prevClient, prevCache := cfg, tokens, client, contentCache
+	prevProfile := paths.ActiveProfile()
+	restoreAuth := auth.SaveState()
+	rollback := func() {
+		cfg, tokens, client, contentCache = prevCfg, prevTokens, prevClient, prevCache
+		paths.SetProfile(prevProfile)
+		restoreAuth()
+	}
+
+	window.DrawStatus(fmt.Sprintf("Switching to profile '%s'...", name))
+	cfg = newCfg
+	paths.SetProfile(name)
+	if err = auth.InitializeAuth(cfg); err != nil {
+		rollback()
+		return err
+	}
+	loggedIn, err := auth.Restore()
+	if errors.Is(err, auth.ErrNotLoggedIn) {
+		var token *oauth2.Token
+		token, err = loginInWindow(window, fmt.Sprintf("Log in to profile '%s'.", name))
+		if err == nil {
+			loggedIn = auth.NewTokenSource(token)
+		}
+	}
+	if err != nil {
+		rollback()
+		return err
+	}
 
-func getIfExists(path string) (*os.File, error) {
-	f, err := os.Open(path)
-	if err != nil && os.IsNotExist(err) {
-		return nil, nil
+	setClient(loggedIn, func() error { return reauthenticateInWindow(window) })
+	notes, err := client.ListNotes()
+	if err != nil {
+		rollback()
+		return err
 	}
-	return f, err
+	applySettings(window)
+	window.SetNotes(notes)
+	window.Preview.SetSource(contentCache)
+	return nil
 }
 
-func exitWithFatalError(err error) {
-	w.Move(0, 0)
-	w.ClearScreen()
-	fmt.Fprintf(os.Stderr, "error: %s\n", err) // TODO: fix weird % at end of line
-	os.Exit(-1)
+// logToFile sends log messages to LOG_FILE in the state folder (or nowhere,
+// if it can't be opened) until the returned func is called, so that they
+// don't land on top of the UI.
+func logToFile() func() {
+	prevLogger, prevOutput, prevFlags := slog.Default(), log.Writer(), log.Flags()
+	var out io.Writer = io.Discard
+	var file *os.File
+	if dir, err := paths.EnsureStateFolder(); err == nil {
+		file, err = os.OpenFile(filepath.Join(dir, LOG_FILE), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err == nil {
+			out = file
+		}
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(out, nil)))
+	return func() {
+		slog.SetDefault(prevLogger)
+		log.SetOutput(prevOutput)
+		log.SetFlags(prevFlags)
+		if file != nil {
+			file.Close()
+		}
+	}
 }
 
-func initState(url string) (*w.MainWindow, func()) {
-	auth.InitializeAuth()
-	token, err := auth.Login()
-	if err != nil {
+func initState() (*w.MainWindow, func()) {
+	if err := initClient(); err != nil {
 		exitWithFatalError(err) // TODO: better error message
 	}
-
-	client = nc.NewClient(url, token)
+	restoreLog := logToFile()
 
 	fd := os.Stdin.Fd()
 	w.DisableEcho(fd)
@@ -164,6 +301,7 @@ func initState(url string) (*w.MainWindow, func()) {
 		w.ShowCursor()
 		exitWithFatalError(err) // TODO: better error message
 	}
+	w.EnableMouse()
 	// defer term.Restore(int(fd), oldState)
 
 	w.ClearScreen()
@@ -184,157 +322,108 @@ func initState(url string) (*w.MainWindow, func()) {
 		exitWithFatalError(err) // TODO: better error message
 	}
 
-	w.SetPalette(w.DefaultPalette)
+	if err := w.ListenForResize(); err != nil {
+		term.Restore(int(fd), oldState)
+		w.ShowCursor()
+		exitWithFatalError(err) // TODO: better error message
+	}
+
 	window := w.NewMainWindow(termw, termh, notes)
+	applySettings(window)
+	w.SetPalette(w.DefaultPalette)
+	window.EnablePreview(contentCache)
+	client.Reauthenticate = func() error { return reauthenticateInWindow(window) }
+	auth.PromptPassphrase = func(confirm bool) ([]byte, error) {
+		// Ask on a clear screen, then put the UI back
+		defer window.Draw()
+		w.ClearScreen()
+		w.Move(1, 1)
+		w.ShowCursor()
+		defer w.HideCursor()
+		w.DisableMouse()
+		defer w.EnableMouse()
+		return auth.ReadPassphrase(confirm)
+	}
+	window.Profile = cfg.Profile
 	window.Draw()
 
 	return window, func() {
+		w.DisableMouse()
 		term.Restore(int(fd), oldState)
 		w.ShowCursor()
+		restoreLog()
 	}
 }
 
 func main() {
 	var debugFlag *bool = flag.Bool("debug", false, "Enable debugging features")
-	var urlParam *string = flag.String("url", "https://notes.quemot.dev/", "Base URL for the Notes API service")
+	var configParam *string = flag.String("config", "", "Config file (default: $NOTES_CONFIG, then "+config.DefaultPath()+")")
+	var profileParam *string = flag.String("profile", "", "Profile from the config file to use ($NOTES_PROFILE)")
+	var urlParam *string = flag.String("url", config.DEFAULT_API_URL, "Base URL for the Notes API service ($NOTES_API_URL)")
+	var issuerParam *string = flag.String("issuer", config.DEFAULT_ISSUER_URL, "OIDC issuer URL used to log in ($NOTES_ISSUER_URL)")
+	var clientIDParam *string = flag.String("client-id", config.DEFAULT_CLIENT_ID, "OIDC client ID ($NOTES_CLIENT_ID)")
+	var scopesParam *string = flag.String("scopes", strings.Join(config.DefaultScopes, " "), "Space-separated OIDC scopes to request ($NOTES_SCOPES)")
+	var loginFlowParam *string = flag.String("login-flow", config.LOGIN_FLOW_AUTO, "How to log in: "+strings.Join(config.LoginFlows, ", ")+" ($NOTES_LOGIN_FLOW)")
+	var tokenStoreParam *string = flag.String("token-store", config.TOKEN_STORE_AUTO, "Where to save the login: "+strings.Join(config.TokenStores, ", ")+" ($NOTES_TOKEN_STORE)")
+	var editorParam *string = flag.String("editor", "", "Editor command, e.g. 'code --wait {path}' (default: editor in the config file, then $VISUAL, then $EDITOR)")
+	var editorReadOnlyParam *string = flag.String("editor-readonly-flags", "", "Flags passed to the editor when viewing read-only (default: -R for vim/nvim, -v for nano)")
+	flag.Usage = printUsage
 	flag.Parse()
 
+	var err error
+	if err = paths.MigrateLegacyDir(); err != nil {
+		fmt.Fprintf(os.Stderr, "notes: warning: could not move files out of %s: %s\n", paths.LegacyDir(), err)
+	}
+	configFile, cfg, err = config.Load(*configParam, *profileParam)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "notes: %s\n", err)
+		os.Exit(EXIT_USAGE)
+	}
+	// Flags only override the config if actually given
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "url":
+			cfg.APIURL = *urlParam
+		case "issuer":
+			cfg.IssuerURL = *issuerParam
+		case "client-id":
+			cfg.ClientID = *clientIDParam
+		case "scopes":
+			cfg.Scopes = config.ParseScopes(*scopesParam)
+		case "login-flow":
+			cfg.LoginFlow = *loginFlowParam
+		case "token-store":
+			cfg.TokenStore = *tokenStoreParam
+		case "editor":
+			cfg.Editor = *editorParam
+		case "editor-readonly-flags":
+			cfg.EditorReadOnlyFlags = *editorReadOnlyParam
+		}
+	})
+	if err = validateConfig(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "notes: invalid configuration: %s\n", err)
+		os.Exit(EXIT_USAGE)
+	}
+	paths.SetProfile(cfg.Profile)
+
 	w.Debug = *debugFlag
 
-	window, cleanup := initState(*urlParam)
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(flag.Args()))
+	}
+
+	window, cleanup := initState()
 	defer cleanup()
 
-	var input uint32 = 0
-	exiting := false
 	for !exiting {
 		// TODO: interrupts
-		input = w.ReadInput()
-		idx := window.Selection
-		switch input {
-		case 'k': // up
-			if idx <= 0 {
-				idx = len(window.Notes) - 1
-			} else {
-				idx -= 1
-			}
-		case 'j': // down
-			if idx >= len(window.Notes)-1 {
-				idx = 0
-			} else {
-				idx += 1
-			}
-		case '\u000e': // CTRL+N
-			values := window.RequestInput("Create note", []string{"Title"})
-			if values != nil {
-				// TODO: Make all of these asynchronous
-				newNote, err := client.CreateNote(values["Title"])
-				if err != nil {
-					window.ShowErrorBox(err)
-				} else {
-					window.Notes = append(window.Notes, newNote)
-				}
-			}
-		case '\u0012': // CTRL+R
-			values := window.RequestInputWithDefaults("Rename note", map[string]string{"Title": window.Notes[idx].Title})
-			if values != nil {
-				note := window.Notes[idx]
-				// TODO: Make all of these asynchronous
-				err := client.UpdateNote(note.ID, values["Title"])
-				if err != nil {
-					window.ShowErrorBox(err)
-				} else {
-					updatedNote, err := client.GetNote(note.ID)
-					if err != nil {
-						window.ShowErrorBox(err)
-						window.Notes[idx].Title = values["Title"]
-					} else {
-						window.Notes[idx] = updatedNote
-					}
-				}
-			}
-		case '\u000d': // Enter
-			note := window.Notes[idx]
-			content, err := client.GetNoteContent(note.ID)
-			if err != nil {
-				window.ShowErrorBox(err)
-			} else {
-				// TODO: This should be a formal cache of some sort, maybe a local DB with the hash + contents
-				result, err := createLocalNoteCopy(window, content)
-				if err != nil {
-					window.ShowErrorBox(fmt.Errorf("error when creating temp file: %w", err))
-				} else if !result.IsCancelled {
-					path := result.Path
-					OpenEditor(path)
-
-					newContent, err := os.ReadFile(path)
-					if err == nil {
-						if result.OpenReadOnly {
-							window.ShowInfoBox("File was opened as read-only and so was not saved.")
-						} else {
-							err := client.UpdateNoteContent(note.ID, newContent)
-							if err != nil {
-								window.ShowErrorBox(err)
-							} else {
-								_ = os.Remove(path)
-							}
-						}
-					}
-				}
-			}
-			w.HideCursor()
-		case '\u0004': // CTRL+D
-			showtitle := window.Notes[idx].Title
-			if len(showtitle) > 20 {
-				showtitle = showtitle[:20]
-			}
-			confirmmsg := fmt.Sprintf("Delete note '%s'?", showtitle)
-			yes := window.RequestConfirmation(confirmmsg)
-			if yes {
-				err := client.DeleteNote(window.Notes[idx].ID)
-				if err != nil {
-					// TODO: Title describing failed action
-					window.ShowErrorBox(err)
-				} else {
-					window.Notes = append(window.Notes[:idx], window.Notes[idx+1:]...)
-				}
-			}
-		case '\u0009': // CTRL+I
-			values := window.RequestInput("Enter path to existing note", []string{"Path"})
-			if values != nil {
-				path := values["Path"]
-				_, defaultTitle := filepath.Split(path)
-				values = window.RequestInputWithDefaults("New name", map[string]string{"Title": defaultTitle})
-				// TODO: Move this to a separate func to avoid Matryoshka effect
-				if values != nil {
-					content, err := os.ReadFile(path)
-					if err != nil {
-						window.ShowErrorBox(err)
-					} else {
-						note, err := client.CreateNote(values["Title"])
-						if err != nil {
-							window.ShowErrorBox(err)
-						} else {
-							err := client.UpdateNoteContent(note.ID, content)
-							if err != nil {
-								window.ShowErrorBox(fmt.Errorf("error while setting content; cleaning up: %w", err))
-								err := client.DeleteNote(note.ID)
-								if err != nil {
-									window.ShowErrorBox(fmt.Errorf("error while cleaning up; manually update content for note %d: %w", note.ID, err))
-								}
-							} else {
-								window.Notes = append(window.Notes, note)
-							}
-						}
-					}
-				}
-			}
-		case '\u0008': // CTRL+H
-			window.HelpCollapsed = !window.HelpCollapsed
-		case 'q', '\u0003': // q/CTRL+C
-			exiting = window.RequestConfirmation("Are you sure you want to leave?")
+		key := w.ReadKey()
+		if key.Code == w.KEY_RESIZE {
+			window.ResizeToTerminal()
+		} else if key.Code != w.KEY_REFRESH {
+			handleKey(window, key)
 		}
-		window.LastKeyWindow.Value = fmt.Sprintf(" 0x%x", input)
-		window.Selection = idx
+		window.LastKeyWindow.Value = " " + key.String()
 		window.Draw()
 	}
 
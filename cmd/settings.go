@@ -0,0 +1,70 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/mrshanahan/notes-api/pkg/notes"
+	"mrshanahan.com/notes-term/internal/config"
+	"mrshanahan.com/notes-term/internal/keymap"
+	w "mrshanahan.com/notes-term/internal/window"
+)
+
+// validateConfig checks c, including its keys.
+func validateConfig(c *config.Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	_, err := newKeymap(c)
+	return err
+}
+
+// applySettings applies the UI parts of cfg (keys, colors & sort order) to
+// window. cfg must have passed validateConfig.
+func applySettings(window *w.MainWindow) {
+	w.DefaultPalette = palette(cfg.Colors.Default)
+	w.HighlightPalette = palette(cfg.Colors.Highlight)
+	w.ErrorPalette = palette(cfg.Colors.Error)
+	w.CodePalette = palette(cfg.Colors.Code)
+
+	keys, _ = newKeymap(cfg)
+	helpKeys := actionKeys(cfg, findAction("help"))
+	helpKey := "Help"
+	if len(helpKeys) > 0 {
+		helpKey = keymap.Label(helpKeys[0])
+	}
+	window.SetHelpText(helpText(cfg), helpKey)
+	window.SetSort(noteLess(cfg.Sort))
+	window.WrapSelection = cfg.WrapSelection
+}
+
+func palette(colors config.ColorPair) *w.Palette {
+	return w.NewPalette(colors.Background.Code(), colors.Foreground.Code())
+}
+
+// noteLess returns how to order notes for the given sort order, or nil to
+// keep the order they come from the server in. Dates sort newest first.
+func noteLess(order config.SortOrder) func(a, b *notes.Note) bool {
+	switch order {
+	case config.SORT_TITLE:
+		return func(a, b *notes.Note) bool {
+			return strings.ToLower(a.Title) < strings.ToLower(b.Title)
+		}
+	case config.SORT_CREATED:
+		return func(a, b *notes.Note) bool {
+			return a.CreatedOn.After(b.CreatedOn)
+		}
+	case config.SORT_UPDATED:
+		return func(a, b *notes.Note) bool {
+			return a.UpdatedOn.After(b.UpdatedOn)
+		}
+	}
+	return nil
+}
+
+// sortNotes orders ns by the configured sort order.
+func sortNotes(ns []*notes.Note) {
+	if less := noteLess(cfg.Sort); less != nil {
+		sort.SliceStable(ns, func(i, j int) bool { return less(ns[i], ns[j]) })
+	}
+}
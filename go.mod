@@ -5,15 +5,15 @@ go 1.21
 toolchain go1.21.1
 
 require (
+	github.com/BurntSushi/toml v1.4.0
+	github.com/coreos/go-oidc/v3 v3.10.0
+	github.com/godbus/dbus/v5 v5.1.0
 	github.com/mrshanahan/notes-api v0.0.0-20240616213724-3d7cbaab01ea
 	github.com/pkg/term v1.1.0
+	golang.org/x/crypto v0.24.0
+	golang.org/x/oauth2 v0.21.0
 	golang.org/x/sys v0.21.0
 	golang.org/x/term v0.21.0
 )
 
-require (
-	github.com/coreos/go-oidc/v3 v3.10.0 // indirect
-	github.com/go-jose/go-jose/v4 v4.0.2 // indirect
-	golang.org/x/crypto v0.24.0 // indirect
-	golang.org/x/oauth2 v0.21.0 // indirect
-)
+require github.com/go-jose/go-jose/v4 v4.0.2 // indirect
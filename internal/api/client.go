@@ -0,0 +1,224 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	nc "github.com/mrshanahan/notes-api/pkg/client"
+	"github.com/mrshanahan/notes-api/pkg/notes"
+	"golang.org/x/oauth2"
+)
+
+// TokenSource provides access tokens for API requests. Refresh gets a new
+// access token even if the current one hasn't expired yet, e.g. because the
+// server rejected it.
+type TokenSource interface {
+	oauth2.TokenSource
+	Refresh() error
+}
+
+// Client is a notes API client that asks a token source for the access token
+// on every request, so that refreshed tokens are picked up during long
+// sessions. The underlying client is rebuilt whenever the token changes.
+//
+// If the server rejects a token the client refreshes it & retries once. If
+// that doesn't help, or there's no valid token to begin with (e.g. the access
+// token has expired & so has the refresh token), Reauthenticate is called (if
+// set) before retrying.
+type Client struct {
+	*session
+	// Logs the user in again, e.g. through the device flow. Called on the
+	// goroutine making the request.
+	Reauthenticate func() error
+}
+
+// session is the token state shared between a Client & its Background view.
+type session struct {
+	URL string
+
+	tokens    TokenSource
+	mu        sync.Mutex
+	token     *oauth2.Token
+	client    *nc.Client
+	refreshMu sync.Mutex
+}
+
+func NewClient(url string, tokens TokenSource) *Client {
+	return &Client{session: &session{URL: url, tokens: tokens}}
+}
+
+// Background returns a view of the client for use off the main goroutine: it
+// shares tokens with c but never calls Reauthenticate.
+func (c *Client) Background() *Client {
+	return &Client{session: c.session}
+}
+
+// ErrUnauthorized matches (with errors.Is) the API rejecting the access
+// token.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// StatusError is the API responding with an unsuccessful status code.
+type StatusError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *StatusError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+func (e *StatusError) Is(target error) bool {
+	return target == ErrUnauthorized && e.StatusCode == http.StatusUnauthorized
+}
+
+// IsUnauthorized reports whether err is the API rejecting the access token.
+func IsUnauthorized(err error) bool {
+	return errors.Is(err, ErrUnauthorized)
+}
+
+// statusError turns an error from the underlying client into a StatusError
+// if it is about the response's status code. That client only reports it in
+// the message, so this is the one place that depends on its wording.
+func statusError(err error) error {
+	if err == nil {
+		return nil
+	}
+	const prefix = "invalid status code: "
+	msg := err.Error()
+	i := strings.Index(msg, prefix)
+	if i < 0 {
+		return err
+	}
+	var code int
+	if _, scanErr := fmt.Sscanf(msg[i+len(prefix):], "%d", &code); scanErr != nil {
+		return err
+	}
+	return &StatusError{code, err}
+}
+
+// current returns a client using a currently valid access token, refreshing
+// it first if needed.
+func (s *session) current() (*nc.Client, *oauth2.Token, error) {
+	token, err := s.tokens.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client == nil || s.token.AccessToken != token.AccessToken {
+		s.token = token
+		s.client = nc.NewClient(s.URL, token)
+	}
+	return s.client, s.token, nil
+}
+
+// refresh replaces rejected with a new token, unless another request has
+// already done so.
+func (s *session) refresh(rejected *oauth2.Token) error {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	token, err := s.tokens.Token()
+	if err == nil && token.AccessToken != rejected.AccessToken {
+		return nil
+	}
+	return s.tokens.Refresh()
+}
+
+// do runs op, retrying once with a new token if the current one is rejected
+// or can't be had at all.
+func (c *Client) do(op func(client *nc.Client) error) error {
+	client, token, err := c.current()
+	if err == nil {
+		err = statusError(op(client))
+		if !IsUnauthorized(err) {
+			return err
+		}
+		refreshErr := c.refresh(token)
+		if refreshErr == nil {
+			return c.retry(op)
+		}
+		err = fmt.Errorf("%w (could not refresh login: %w)", err, refreshErr)
+	} else {
+		err = fmt.Errorf("could not get access token: %w", err)
+	}
+
+	if c.Reauthenticate == nil {
+		return err
+	}
+	if authErr := c.Reauthenticate(); authErr != nil {
+		return fmt.Errorf("%w (could not log in again: %w)", err, authErr)
+	}
+	return c.retry(op)
+}
+
+// retry runs op a second time, with whatever token is current now.
+func (c *Client) retry(op func(client *nc.Client) error) error {
+	client, _, err := c.current()
+	if err != nil {
+		return fmt.Errorf("could not get access token: %w", err)
+	}
+	return statusError(op(client))
+}
+
+func (c *Client) ListNotes() ([]*notes.Note, error) {
+	var ns []*notes.Note
+	err := c.do(func(client *nc.Client) (err error) {
+		ns, err = client.ListNotes()
+		return
+	})
+	return ns, err
+}
+
+func (c *Client) CreateNote(title string) (*notes.Note, error) {
+	var note *notes.Note
+	err := c.do(func(client *nc.Client) (err error) {
+		note, err = client.CreateNote(title)
+		return
+	})
+	return note, err
+}
+
+func (c *Client) GetNote(id int64) (*notes.Note, error) {
+	var note *notes.Note
+	err := c.do(func(client *nc.Client) (err error) {
+		note, err = client.GetNote(id)
+		return
+	})
+	return note, err
+}
+
+func (c *Client) UpdateNote(id int64, title string) error {
+	return c.do(func(client *nc.Client) error {
+		return client.UpdateNote(id, title)
+	})
+}
+
+func (c *Client) DeleteNote(id int64) error {
+	return c.do(func(client *nc.Client) error {
+		return client.DeleteNote(id)
+	})
+}
+
+func (c *Client) GetNoteContent(id int64) ([]byte, error) {
+	var content []byte
+	err := c.do(func(client *nc.Client) (err error) {
+		content, err = client.GetNoteContent(id)
+		return
+	})
+	return content, err
+}
+
+func (c *Client) UpdateNoteContent(id int64, content []byte) error {
+	return c.do(func(client *nc.Client) error {
+		return client.UpdateNoteContent(id, content)
+	})
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+// fakeTokens hands out token (or fails with tokenErr); Refresh switches to
+// refreshed unless refreshErr is set.
+type fakeTokens struct {
+	token      *oauth2.Token
+	tokenErr   error
+	refreshed  *oauth2.Token
+	refreshErr error
+	refreshes  int
+}
+
+func (t *fakeTokens) Token() (*oauth2.Token, error) {
+	if t.tokenErr != nil {
+		return nil, t.tokenErr
+	}
+	return t.token, nil
+}
+
+func (t *fakeTokens) Refresh() error {
+	t.refreshes++
+	if t.refreshErr != nil {
+		return t.refreshErr
+	}
+	t.token, t.tokenErr = t.refreshed, nil
+	return nil
+}
+
+// notesServer accepts only the given access token.
+func notesServer(t *testing.T, valid string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+valid {
+			http.Error(w, "bad token", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `[{"id": 1, "title": "note"}]`)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClientTokens(t *testing.T) {
+	tests := []struct {
+		name    string
+		tokens  *fakeTokens
+		reauth  bool // Whether Reauthenticate is set & logs in with "good"
+		wantErr bool
+		// Whether Reauthenticate should have been called
+		wantReauth bool
+	}{
+		{"valid token", &fakeTokens{token: &oauth2.Token{AccessToken: "good"}}, true, false, false},
+		{"rejected token is refreshed",
+			&fakeTokens{token: &oauth2.Token{AccessToken: "old"}, refreshed: &oauth2.Token{AccessToken: "good"}},
+			true, false, false},
+		{"rejected token can't be refreshed",
+			&fakeTokens{token: &oauth2.Token{AccessToken: "old"}, refreshErr: errors.New("refresh token expired")},
+			true, false, true},
+		{"no token to be had",
+			&fakeTokens{tokenErr: errors.New("refresh token expired")},
+			true, false, true},
+		{"no token without Reauthenticate",
+			&fakeTokens{tokenErr: errors.New("refresh token expired")},
+			false, true, false},
+		{"rejected token without Reauthenticate",
+			&fakeTokens{token: &oauth2.Token{AccessToken: "old"}, refreshErr: errors.New("refresh token expired")},
+			false, true, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := notesServer(t, "good")
+			client := NewClient(server.URL, test.tokens)
+			reauthed := false
+			if test.reauth {
+				client.Reauthenticate = func() error {
+					reauthed = true
+					test.tokens.token, test.tokens.tokenErr = &oauth2.Token{AccessToken: "good"}, nil
+					return nil
+				}
+			}
+
+			ns, err := client.ListNotes()
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("ListNotes() returned no error")
+				}
+			} else if err != nil {
+				t.Errorf("ListNotes() returned error: %v", err)
+			} else if len(ns) != 1 {
+				t.Errorf("ListNotes() returned %d notes, want 1", len(ns))
+			}
+			if reauthed != test.wantReauth {
+				t.Errorf("Reauthenticate called: %v, want %v", reauthed, test.wantReauth)
+			}
+		})
+	}
+}
+
+func TestClientRetriesOnce(t *testing.T) {
+	server := notesServer(t, "never")
+	tokens := &fakeTokens{token: &oauth2.Token{AccessToken: "old"}, refreshed: &oauth2.Token{AccessToken: "new"}}
+	client := NewClient(server.URL, tokens)
+	reauths := 0
+	client.Reauthenticate = func() error {
+		reauths++
+		return nil
+	}
+
+	_, err := client.ListNotes()
+	if !IsUnauthorized(err) {
+		t.Errorf("ListNotes() = %v, want an unauthorized error", err)
+	}
+	if tokens.refreshes != 1 || reauths != 0 {
+		t.Errorf("refreshed %d times & reauthenticated %d times, want 1 & 0", tokens.refreshes, reauths)
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		err          error
+		code         int // 0 if it shouldn't be a StatusError
+		unauthorized bool
+	}{
+		{errors.New("invalid status code: 401 (response: bad token)"), 401, true},
+		{errors.New("invalid status code: 404 (response: not found)"), 404, false},
+		{fmt.Errorf("listing notes: %w", errors.New("invalid status code: 500 (response: )")), 500, false},
+		{errors.New("error invoking API: connection refused"), 0, false},
+		{errors.New("invalid status code: teapot"), 0, false},
+	}
+	for _, test := range tests {
+		err := statusError(test.err)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) != (test.code != 0) || (statusErr != nil && statusErr.StatusCode != test.code) {
+			t.Errorf("statusError(%q) = %#v, want status code %d", test.err, err, test.code)
+		}
+		if IsUnauthorized(err) != test.unauthorized {
+			t.Errorf("IsUnauthorized(statusError(%q)) = %v, want %v", test.err, !test.unauthorized, test.unauthorized)
+		}
+		if err.Error() != test.err.Error() {
+			t.Errorf("statusError(%q) changed the message to %q", test.err, err)
+		}
+	}
+	if statusError(nil) != nil {
+		t.Error("statusError(nil) != nil")
+	}
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrNotLoggedIn = errors.New("not logged in; run `notes login`")
+)
+
+// Identity is who the saved login belongs to, according to its ID token.
+type Identity struct {
+	Subject  string    `json:"sub"`
+	Username string    `json:"preferred_username"`
+	Name     string    `json:"name"`
+	Email    string    `json:"email"`
+	Expiry   time.Time `json:"-"`
+}
+
+// WhoAmI verifies the saved ID token & returns the identity in it. The login
+// is refreshed first if the ID token has expired. Never starts a new login.
+func WhoAmI(ctx context.Context) (*Identity, error) {
+	token, err := LoadToken()
+	if err != nil {
+		return nil, err
+	}
+	if token.AccessToken == "" && token.RefreshToken == "" {
+		return nil, ErrNotLoggedIn
+	}
+
+	tokens := NewTokenSource(token)
+	idToken, err := verifyIDToken(ctx, token)
+	var expiredErr *oidc.TokenExpiredError
+	if errors.As(err, &expiredErr) || IDToken(token) == "" {
+		if err = tokens.Refresh(); err != nil {
+			return nil, fmt.Errorf("login has expired & could not be refreshed (%w); run `notes login`", err)
+		}
+		token, err = tokens.Token()
+		if err != nil {
+			return nil, err
+		}
+		idToken, err = verifyIDToken(ctx, token)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{}
+	if err = idToken.Claims(identity); err != nil {
+		return nil, fmt.Errorf("could not read ID token claims: %w", err)
+	}
+	identity.Expiry = idToken.Expiry
+	return identity, nil
+}
+
+func verifyIDToken(ctx context.Context, token *oauth2.Token) (*oidc.IDToken, error) {
+	raw := IDToken(token)
+	if raw == "" {
+		return nil, errors.New("saved login has no ID token; run `notes login`")
+	}
+	return clientAuthConfig.KeycloakIDTokenVerifier.Verify(ctx, raw)
+}
+
+// Logout revokes the saved login at the provider & deletes it locally. The
+// local token is deleted even if revoking fails.
+func Logout(ctx context.Context) error {
+	token, err := LoadToken()
+	if err != nil {
+		return err
+	}
+
+	var revokeErr error
+	if clientAuthConfig.KeycloakRevocationUri == "" {
+		revokeErr = errors.New("provider has no revocation endpoint")
+	} else if token.RefreshToken != "" {
+		// Revoking the refresh token ends the whole session
+		revokeErr = revokeToken(ctx, token.RefreshToken, "refresh_token")
+	} else if token.AccessToken != "" {
+		revokeErr = revokeToken(ctx, token.AccessToken, "access_token")
+	}
+
+	if err = DeleteToken(); err != nil {
+		return err
+	}
+	if revokeErr != nil {
+		return fmt.Errorf("removed local login, but could not revoke it: %w", revokeErr)
+	}
+	return nil
+}
+
+// revokeToken revokes token per RFC 7009.
+func revokeToken(ctx context.Context, token string, hint string) error {
+	form := url.Values{
+		"token":           {token},
+		"token_type_hint": {hint},
+		"client_id":       {clientAuthConfig.KeycloakLoginConfig.ClientID},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", clientAuthConfig.KeycloakRevocationUri, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("invalid status code: %d (response: %s)", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
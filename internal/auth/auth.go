@@ -2,11 +2,15 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"os"
 
 	"github.com/coreos/go-oidc/v3/oidc"
 	"golang.org/x/oauth2"
+	"mrshanahan.com/notes-term/internal/config"
 )
 
 var (
@@ -14,69 +18,201 @@ var (
 )
 
 type Config struct {
-	KeycloakBaseUri     string
-	KeycloakLoginConfig oauth2.Config
+	KeycloakBaseUri         string
+	KeycloakLoginConfig     oauth2.Config
+	KeycloakIDTokenVerifier *oidc.IDTokenVerifier
+	// Empty if the provider doesn't advertise one
+	KeycloakRevocationUri string
+	// One of config.LOGIN_FLOW_*
+	LoginFlow string
 }
 
-func buildAuthConfig(context context.Context) *Config {
-	baseProviderUrl := "https://auth.notes.quemot.dev/realms/notes"
-	provider, err := oidc.NewProvider(context, baseProviderUrl)
+func buildAuthConfig(ctx context.Context, cfg *config.Config) (*Config, error) {
+	provider, err := oidc.NewProvider(ctx, cfg.IssuerURL)
 	if err != nil {
-		panic("Could not load OIDC configuration: " + err.Error())
+		return nil, fmt.Errorf("could not load OIDC configuration from issuer '%s': %w", cfg.IssuerURL, err)
+	}
+
+	var claims struct {
+		RevocationEndpoint string `json:"revocation_endpoint"`
+	}
+	if err := provider.Claims(&claims); err != nil {
+		slog.Warn("could not read OIDC provider metadata", "error", err)
 	}
 
 	config := &Config{
 		KeycloakLoginConfig: oauth2.Config{
-			ClientID: "notes-cli",
+			ClientID: cfg.ClientID,
 			Endpoint: provider.Endpoint(),
-			Scopes:   []string{"profile", "email", oidc.ScopeOpenID},
+			Scopes:   cfg.Scopes,
 		},
-		KeycloakBaseUri: baseProviderUrl,
-		// KeycloakIDTokenVerifier: provider.Verifier(&oidc.Config{ClientID: AuthConfig.KeycloakLoginConfig.ClientID}),
+		KeycloakBaseUri:         cfg.IssuerURL,
+		KeycloakIDTokenVerifier: provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+		KeycloakRevocationUri:   claims.RevocationEndpoint,
+		LoginFlow:               cfg.LoginFlow,
 	}
-	return config
+	return config, nil
+}
 
+// InitializeAuth discovers the OIDC provider configured in cfg & sets up its
+// token store. Must be called before anything else in this package.
+func InitializeAuth(cfg *config.Config) error {
+	authConfig, err := buildAuthConfig(context.Background(), cfg)
+	if err != nil {
+		return err
+	}
+	store, err := newTokenStore(cfg)
+	if err != nil {
+		return err
+	}
+	clientAuthConfig, tokenStore = authConfig, store
+	return nil
 }
 
-func InitializeAuth() {
-	clientAuthConfig = buildAuthConfig(context.Background())
+// SaveState returns a func that puts back the current auth configuration,
+// e.g. to undo a failed switch to another profile.
+func SaveState() func() {
+	savedConfig, savedStore := clientAuthConfig, tokenStore
+	return func() { clientAuthConfig, tokenStore = savedConfig, savedStore }
 }
 
-func Login() (*oauth2.Token, error) {
+// Restore returns a token source for the saved login, refreshing it first if
+// it has expired. Returns ErrNotLoggedIn if there is no usable saved login.
+func Restore() (*TokenSource, error) {
 	token, err := LoadToken()
 	if err != nil {
 		return nil, err
 	}
 
+	tokens := NewTokenSource(token)
 	if IsValid(token) {
-		return token, nil
+		return tokens, nil
+	}
+	if token.RefreshToken != "" {
+		err = tokens.Refresh()
+		if err == nil {
+			return tokens, nil
+		}
+		slog.Info("could not refresh token", "error", err)
+	}
+	return nil, ErrNotLoggedIn
+}
+
+// Login returns a token source for API requests, refreshing tokens as they
+// expire & saving the results. If there is no saved token or it can't be
+// refreshed, the user is asked to log in again (see StartLogin).
+func Login() (*TokenSource, error) {
+	tokens, err := Restore()
+	if !errors.Is(err, ErrNotLoggedIn) {
+		return tokens, err
+	}
+
+	token, err := InteractiveLogin(context.Background(), clientAuthConfig.LoginFlow, os.Stderr)
+	if err != nil {
+		return nil, err
 	}
+	return NewTokenSource(token), nil
+}
 
-	ctx := context.Background()
+// PendingLogin is an interactive login waiting for the user to complete it
+// in a browser.
+type PendingLogin interface {
+	// Instructions tells the user how to complete the login.
+	Instructions() []string
+	// Wait waits for the user to complete the login (or ctx to be cancelled)
+	// & saves the resulting token.
+	Wait(ctx context.Context) (*oauth2.Token, error)
+}
+
+// StartLogin begins an interactive login using the configured flow (see
+// StartLoginWith).
+func StartLogin(ctx context.Context) (PendingLogin, error) {
+	return StartLoginWith(ctx, clientAuthConfig.LoginFlow)
+}
+
+// StartLoginWith begins an interactive login using flow, one of
+// config.LOGIN_FLOW_*. With "auto" the browser flow is used if a browser can
+// be opened, falling back to the device flow otherwise, e.g. over SSH.
+func StartLoginWith(ctx context.Context, flow string) (PendingLogin, error) {
+	requested := flow
+	if flow == config.LOGIN_FLOW_AUTO || flow == "" {
+		flow = config.LOGIN_FLOW_DEVICE
+		if CanOpenBrowser() {
+			flow = config.LOGIN_FLOW_BROWSER
+		}
+	}
+
+	if flow == config.LOGIN_FLOW_BROWSER {
+		// Returned separately so a failure is a nil PendingLogin, not a nil
+		// *browserLogin
+		login, err := startBrowserLogin()
+		if err == nil {
+			return login, nil
+		}
+		if requested == config.LOGIN_FLOW_BROWSER {
+			return nil, err
+		}
+		slog.Info("could not start browser login; using device flow", "error", err)
+	}
+	login, err := startDeviceLogin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return login, nil
+}
+
+// InteractiveLogin runs a whole interactive login using flow (see
+// StartLoginWith), printing instructions to out.
+func InteractiveLogin(ctx context.Context, flow string, out io.Writer) (*oauth2.Token, error) {
+	login, err := StartLoginWith(ctx, flow)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range login.Instructions() {
+		fmt.Fprintf(out, "> %s\n", line)
+	}
+	return login.Wait(ctx)
+}
+
+// deviceLogin is a pending OAuth device authorization.
+type deviceLogin struct {
+	deviceAuth *oauth2.DeviceAuthResponse
+}
+
+func startDeviceLogin(ctx context.Context) (*deviceLogin, error) {
 	deviceAuth, err := clientAuthConfig.KeycloakLoginConfig.DeviceAuth(ctx)
 	if err != nil {
 		return nil, err
 	}
+	return &deviceLogin{deviceAuth}, nil
+}
 
+func (l *deviceLogin) Instructions() []string {
 	// TODO: Can we make this check loop tighter?
-	completeUrl := deviceAuth.VerificationURIComplete
+	lines := []string{}
+	completeUrl := l.deviceAuth.VerificationURIComplete
 	if completeUrl != "" {
-		fmt.Printf("> Visit the following URL to complete login: %s\n", completeUrl)
+		lines = append(lines, fmt.Sprintf("Visit the following URL to complete login: %s", completeUrl))
 	} else {
-		fmt.Printf("> Visit the following URL and enter the device code to complete login: %s\n", deviceAuth.VerificationURI)
-		fmt.Printf("> Code: %s\n", deviceAuth.UserCode)
+		lines = append(lines,
+			fmt.Sprintf("Visit the following URL and enter the device code to complete login: %s", l.deviceAuth.VerificationURI),
+			fmt.Sprintf("Code: %s", l.deviceAuth.UserCode))
 	}
-	fmt.Printf("\n> Waiting for login (expires at: %s)...\n", deviceAuth.Expiry.Local())
+	return append(lines, "", fmt.Sprintf("Waiting for login (expires at: %s)...", l.deviceAuth.Expiry.Local().Format("15:04:05")))
+}
 
-	token, err = clientAuthConfig.KeycloakLoginConfig.DeviceAccessToken(ctx, deviceAuth)
+func (l *deviceLogin) Wait(ctx context.Context) (*oauth2.Token, error) {
+	token, err := clientAuthConfig.KeycloakLoginConfig.DeviceAccessToken(ctx, l.deviceAuth)
 	if err != nil {
 		return nil, err // TODO: Better error message here?
 	}
+	saveLoginToken(token)
+	return token, nil
+}
 
-	err = SaveToken(token)
+func saveLoginToken(token *oauth2.Token) {
+	err := SaveToken(token)
 	if err != nil {
 		slog.Warn("could not save token", "error", err)
 	}
-
-	return token, nil
 }
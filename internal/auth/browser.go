@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	BROWSER_LOGIN_TIMEOUT  = 5 * time.Minute
+	LOOPBACK_CALLBACK_PATH = "/callback"
+)
+
+var (
+	// Replaced in tests
+	openBrowser = OpenBrowser
+)
+
+// browserLogin is a pending authorization code login with PKCE. The
+// provider redirects back to a listener on a random loopback port.
+type browserLogin struct {
+	config   oauth2.Config
+	url      string
+	state    string
+	verifier string
+	server   *http.Server
+	results  chan callbackResult
+}
+
+type callbackResult struct {
+	code string
+	err  error
+}
+
+func startBrowserLogin() (*browserLogin, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("could not listen for the login redirect: %w", err)
+	}
+
+	state, err := randomString()
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	login := &browserLogin{
+		config:   clientAuthConfig.KeycloakLoginConfig,
+		state:    state,
+		verifier: oauth2.GenerateVerifier(),
+		results:  make(chan callbackResult, 1),
+	}
+	login.config.RedirectURL = fmt.Sprintf("http://%s%s", listener.Addr(), LOOPBACK_CALLBACK_PATH)
+	login.url = login.config.AuthCodeURL(login.state, oauth2.S256ChallengeOption(login.verifier))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(LOOPBACK_CALLBACK_PATH, login.handleCallback)
+	login.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go login.server.Serve(listener)
+
+	if err = openBrowser(login.url); err != nil {
+		login.server.Close()
+		return nil, err
+	}
+	return login, nil
+}
+
+func (l *browserLogin) handleCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("state") != l.state {
+		// Not the redirect we're waiting for; ignore it
+		http.Error(w, "Invalid login state.", http.StatusBadRequest)
+		return
+	}
+
+	var result callbackResult
+	if e := query.Get("error"); e != "" {
+		result.err = fmt.Errorf("login failed: %s (%s)", e, query.Get("error_description"))
+		fmt.Fprintf(w, "Login failed: %s. You can close this tab.\n", e)
+	} else if code := query.Get("code"); code == "" {
+		result.err = errors.New("login failed: no authorization code in redirect")
+		http.Error(w, "No authorization code.", http.StatusBadRequest)
+	} else {
+		result.code = code
+		fmt.Fprintln(w, "Logged in to notes. You can close this tab.")
+	}
+
+	select {
+	case l.results <- result:
+	default:
+	}
+}
+
+func (l *browserLogin) Instructions() []string {
+	return []string{
+		"Opened your browser to complete login. If it didn't open, visit:",
+		l.url,
+		"",
+		"Waiting for login...",
+	}
+}
+
+func (l *browserLogin) Wait(ctx context.Context) (*oauth2.Token, error) {
+	defer l.server.Close()
+	ctx, cancel := context.WithTimeout(ctx, BROWSER_LOGIN_TIMEOUT)
+	defer cancel()
+
+	var result callbackResult
+	select {
+	case result = <-l.results:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if result.err != nil {
+		return nil, result.err
+	}
+
+	token, err := l.config.Exchange(ctx, result.code, oauth2.VerifierOption(l.verifier))
+	if err != nil {
+		return nil, fmt.Errorf("could not exchange authorization code: %w", err)
+	}
+	saveLoginToken(token)
+	return token, nil
+}
+
+// CanOpenBrowser reports whether we're likely at a desktop where a browser
+// can be opened, i.e. not over SSH & with a display.
+func CanOpenBrowser() bool {
+	for _, v := range []string{"SSH_CONNECTION", "SSH_CLIENT", "SSH_TTY"} {
+		if os.Getenv(v) != "" {
+			return false
+		}
+	}
+	if runtime.GOOS == "darwin" {
+		return true
+	}
+	if os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+		return false
+	}
+	_, err := exec.LookPath("xdg-open")
+	return err == nil
+}
+
+// OpenBrowser opens url in the user's browser without waiting for it.
+func OpenBrowser(url string) error {
+	opener := "xdg-open"
+	if runtime.GOOS == "darwin" {
+		opener = "open"
+	}
+	cmd := exec.Command(opener, url)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("could not open browser: %w", err)
+	}
+	go cmd.Wait()
+	return nil
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,318 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"mrshanahan.com/notes-term/internal/config"
+)
+
+// withDesktop sets up the environment of a Linux desktop session: a display,
+// no SSH & xdg-open on the PATH.
+func withDesktop(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS != "linux" {
+		t.Skip("display detection is only done on Linux")
+	}
+	for _, v := range []string{"SSH_CONNECTION", "SSH_CLIENT", "SSH_TTY", "WAYLAND_DISPLAY"} {
+		t.Setenv(v, "")
+	}
+	t.Setenv("DISPLAY", ":0")
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "xdg-open"), []byte("#!/bin/sh\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+}
+
+// withBrowser replaces the browser opener with one that fails with err if
+// non-nil & otherwise sends the URL it's asked to open to the returned
+// channel.
+func withBrowser(t *testing.T, err error) chan string {
+	t.Helper()
+	prev := openBrowser
+	t.Cleanup(func() { openBrowser = prev })
+	opened := make(chan string, 1)
+	openBrowser = func(url string) error {
+		if err != nil {
+			return err
+		}
+		opened <- url
+		return nil
+	}
+	return opened
+}
+
+// newAuthServer serves a provider's device authorization & token endpoints.
+// Token requests for authorization codes are sent to the returned channel &
+// answered with a token.
+func newAuthServer(t *testing.T) (*httptest.Server, chan url.Values) {
+	t.Helper()
+	exchanges := make(chan url.Values, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"device_code":      "device-code",
+			"user_code":        "ABCD-EFGH",
+			"verification_uri": "https://auth.example.com/device",
+			"expires_in":       600,
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "authorization_code" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		exchanges <- r.Form
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "browser-access",
+			"refresh_token": "browser-refresh",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+		})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, exchanges
+}
+
+// withAuthServer makes a profile using server as its provider active.
+func withAuthServer(t *testing.T, server *httptest.Server, flow string) *FileStore {
+	t.Helper()
+	store := withProfile(t, server.URL+"/token", t.TempDir())
+	clientAuthConfig.KeycloakLoginConfig.Endpoint.AuthURL = "https://auth.example.com/authorize"
+	clientAuthConfig.KeycloakLoginConfig.Endpoint.DeviceAuthURL = server.URL + "/device"
+	clientAuthConfig.LoginFlow = flow
+	return store
+}
+
+func TestCanOpenBrowser(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want bool
+	}{
+		{"desktop", nil, true},
+		{"Wayland", map[string]string{"DISPLAY": "", "WAYLAND_DISPLAY": "wayland-0"}, true},
+		{"no display", map[string]string{"DISPLAY": ""}, false},
+		{"SSH", map[string]string{"SSH_CONNECTION": "10.0.0.1 50000 10.0.0.2 22"}, false},
+		{"SSH with X forwarding", map[string]string{"SSH_CLIENT": "10.0.0.1 50000 22", "DISPLAY": "localhost:10.0"}, false},
+		{"SSH terminal", map[string]string{"SSH_TTY": "/dev/pts/0"}, false},
+		{"no xdg-open", map[string]string{"PATH": ""}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withDesktop(t)
+			for k, v := range test.env {
+				t.Setenv(k, v)
+			}
+			if got := CanOpenBrowser(); got != test.want {
+				t.Errorf("CanOpenBrowser() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStartLoginChoosesFlow(t *testing.T) {
+	tests := []struct {
+		name       string
+		flow       string
+		desktop    bool
+		browserErr error
+		// "device", "browser" or "error"
+		want string
+	}{
+		{"auto at a desktop", config.LOGIN_FLOW_AUTO, true, nil, "browser"},
+		{"auto without a display", config.LOGIN_FLOW_AUTO, false, nil, "device"},
+		{"unset without a display", "", false, nil, "device"},
+		{"auto when the browser won't open", config.LOGIN_FLOW_AUTO, true, errors.New("no browser"), "device"},
+		{"device at a desktop", config.LOGIN_FLOW_DEVICE, true, nil, "device"},
+		{"browser without a display", config.LOGIN_FLOW_BROWSER, false, nil, "browser"},
+		{"browser when the browser won't open", config.LOGIN_FLOW_BROWSER, true, errors.New("no browser"), "error"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withDesktop(t)
+			if !test.desktop {
+				t.Setenv("DISPLAY", "")
+			}
+			server, _ := newAuthServer(t)
+			withAuthServer(t, server, test.flow)
+			opened := withBrowser(t, test.browserErr)
+
+			login, err := StartLogin(context.Background())
+			got := "error"
+			switch l := login.(type) {
+			case *deviceLogin:
+				got = "device"
+			case *browserLogin:
+				got = "browser"
+				l.server.Close()
+			}
+			if err != nil {
+				got = "error"
+			}
+			if got != test.want {
+				t.Fatalf("StartLogin() = %T, %v; want %s", login, err, test.want)
+			}
+			if browserOpened := len(opened) > 0; browserOpened != (test.want == "browser") {
+				t.Errorf("browser opened: %v", browserOpened)
+			}
+		})
+	}
+}
+
+// startTestBrowserLogin starts a browser login against server, returning it
+// along with the query of the URL the browser was sent to.
+func startTestBrowserLogin(t *testing.T, server *httptest.Server) (*browserLogin, url.Values) {
+	t.Helper()
+	withAuthServer(t, server, config.LOGIN_FLOW_BROWSER)
+	opened := withBrowser(t, nil)
+	login, err := startBrowserLogin()
+	if err != nil {
+		t.Fatalf("startBrowserLogin() returned error: %v", err)
+	}
+	t.Cleanup(func() { login.server.Close() })
+	authURL, err := url.Parse(<-opened)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(authURL.String(), "https://auth.example.com/authorize?") {
+		t.Errorf("opened %s, want the provider's authorization URL", authURL)
+	}
+	return login, authURL.Query()
+}
+
+// redirect sends the browser back to the login's listener with query.
+func redirect(t *testing.T, login *browserLogin, query url.Values) int {
+	t.Helper()
+	resp, err := http.Get(login.config.RedirectURL + "?" + query.Encode())
+	if err != nil {
+		t.Fatalf("redirect failed: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestBrowserLoginPKCE(t *testing.T) {
+	server, _ := newAuthServer(t)
+	login, query := startTestBrowserLogin(t, server)
+
+	if query.Get("code_challenge_method") != "S256" {
+		t.Errorf("code_challenge_method = %q, want S256", query.Get("code_challenge_method"))
+	}
+	sum := sha256.Sum256([]byte(login.verifier))
+	if want := base64.RawURLEncoding.EncodeToString(sum[:]); query.Get("code_challenge") != want {
+		t.Errorf("code_challenge = %q, want %q from the verifier", query.Get("code_challenge"), want)
+	}
+	if n := len(login.verifier); n < 43 || n > 128 {
+		t.Errorf("verifier is %d characters, want 43-128", n)
+	}
+	if query.Get("state") != login.state || login.state == "" {
+		t.Errorf("state = %q, want %q", query.Get("state"), login.state)
+	}
+	redirectURL, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirectURL.Hostname() != "127.0.0.1" || redirectURL.Path != LOOPBACK_CALLBACK_PATH {
+		t.Errorf("redirect_uri = %q, want the loopback listener", query.Get("redirect_uri"))
+	}
+
+	// Each login gets its own
+	other, otherQuery := startTestBrowserLogin(t, server)
+	if other.verifier == login.verifier || otherQuery.Get("state") == query.Get("state") {
+		t.Error("two logins share a verifier or state")
+	}
+}
+
+func TestBrowserLogin(t *testing.T) {
+	server, exchanges := newAuthServer(t)
+	login, query := startTestBrowserLogin(t, server)
+
+	// A redirect with some other state is turned away & doesn't end the login
+	if status := redirect(t, login, url.Values{"state": {"forged"}, "code": {"bad-code"}}); status != http.StatusBadRequest {
+		t.Errorf("redirect with the wrong state returned %d, want %d", status, http.StatusBadRequest)
+	}
+	if status := redirect(t, login, url.Values{"state": {query.Get("state")}, "code": {"good-code"}}); status != http.StatusOK {
+		t.Errorf("redirect returned %d, want %d", status, http.StatusOK)
+	}
+
+	token, err := login.Wait(context.Background())
+	if err != nil || token.AccessToken != "browser-access" {
+		t.Fatalf("Wait() = %+v, %v; want the exchanged token", token, err)
+	}
+	exchange := <-exchanges
+	if exchange.Get("code") != "good-code" {
+		t.Errorf("exchanged code %q, want good-code", exchange.Get("code"))
+	}
+	if exchange.Get("code_verifier") != login.verifier {
+		t.Errorf("exchanged with verifier %q, want %q", exchange.Get("code_verifier"), login.verifier)
+	}
+	if exchange.Get("redirect_uri") != query.Get("redirect_uri") {
+		t.Errorf("exchanged with redirect_uri %q, want %q", exchange.Get("redirect_uri"), query.Get("redirect_uri"))
+	}
+	if saved := loadStored(t, tokenStore); saved == nil || saved.AccessToken != "browser-access" {
+		t.Errorf("saved token = %+v, want the exchanged one", saved)
+	}
+	// The listener is gone once the login is over
+	if _, err := http.Get(login.config.RedirectURL); err == nil {
+		t.Error("listener still accepting connections after Wait()")
+	}
+}
+
+func TestBrowserLoginFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  url.Values
+		status int
+		want   string
+	}{
+		{"error", url.Values{"error": {"access_denied"}, "error_description": {"User said no"}}, http.StatusOK, "access_denied (User said no)"},
+		{"no code", url.Values{}, http.StatusBadRequest, "no authorization code"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, exchanges := newAuthServer(t)
+			login, query := startTestBrowserLogin(t, server)
+
+			test.query.Set("state", query.Get("state"))
+			if status := redirect(t, login, test.query); status != test.status {
+				t.Errorf("redirect returned %d, want %d", status, test.status)
+			}
+			token, err := login.Wait(context.Background())
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("Wait() = %+v, %v; want an error containing %q", token, err, test.want)
+			}
+			if len(exchanges) > 0 {
+				t.Error("Wait() exchanged a code after a failed login")
+			}
+		})
+	}
+}
+
+func TestBrowserLoginTimeout(t *testing.T) {
+	server, _ := newAuthServer(t)
+	login, _ := startTestBrowserLogin(t, server)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	token, err := login.Wait(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait() = %+v, %v; want the deadline to be exceeded", token, err)
+	}
+	if _, err := http.Get(login.config.RedirectURL); err == nil {
+		t.Error("listener still accepting connections after timing out")
+	}
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/godbus/dbus/v5"
+	"mrshanahan.com/notes-term/internal/config"
+	"mrshanahan.com/notes-term/internal/paths"
+)
+
+var (
+	// Set by InitializeAuth for the active profile
+	tokenStore TokenStore
+)
+
+// TokenStore keeps the serialized login for a single profile.
+type TokenStore interface {
+	// Load returns the saved data, or nil if nothing has been saved.
+	Load() ([]byte, error)
+	Save(data []byte) error
+	// Delete removes the saved data; it is not an error if there is none.
+	Delete() error
+	// Name describes the store in messages, e.g. "encrypted file".
+	Name() string
+}
+
+// FileStore saves the login unencrypted to a file only the user can read.
+type FileStore struct {
+	Path string
+}
+
+func (s *FileStore) Load() ([]byte, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (s *FileStore) Save(data []byte) error {
+	return os.WriteFile(s.Path, data, 0600)
+}
+
+func (s *FileStore) Delete() error {
+	err := os.Remove(s.Path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) Name() string {
+	return "file " + s.Path
+}
+
+// plaintextTokenPath is where FileStore keeps the active profile's login, &
+// where all logins were kept before other stores existed.
+func plaintextTokenPath() (string, error) {
+	profileDir, err := paths.EnsureProfileDataFolder()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(profileDir, "token"), nil
+}
+
+// newTokenStore returns the store for the active profile chosen by cfg.
+func newTokenStore(cfg *config.Config) (TokenStore, error) {
+	profileDir, err := paths.EnsureProfileDataFolder()
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.TokenStore {
+	case config.TOKEN_STORE_FILE:
+		path, err := plaintextTokenPath()
+		if err != nil {
+			return nil, err
+		}
+		return &FileStore{path}, nil
+	case config.TOKEN_STORE_ENCRYPTED_FILE:
+		return NewEncryptedFileStore(filepath.Join(profileDir, "token.enc")), nil
+	case config.TOKEN_STORE_SECRET_SERVICE:
+		conn, err := dbus.SessionBus()
+		if err != nil {
+			return nil, fmt.Errorf("could not connect to the session bus for the Secret Service: %w", err)
+		}
+		if !SecretServiceAvailable(conn) {
+			return nil, errors.New("the Secret Service isn't running (is a keyring like gnome-keyring or KeePassXC set up?)")
+		}
+		return NewSecretServiceStore(conn, cfg.Profile), nil
+	case config.TOKEN_STORE_AUTO, "":
+		if conn, err := dbus.SessionBus(); err == nil && SecretServiceAvailable(conn) {
+			return NewSecretServiceStore(conn, cfg.Profile), nil
+		}
+		return NewEncryptedFileStore(filepath.Join(profileDir, "token.enc")), nil
+	default:
+		return nil, fmt.Errorf("unknown token store '%s'", cfg.TokenStore)
+	}
+}
+
+// migratePlaintextToken moves a login saved by older versions, which always
+// used a plaintext file, into store. Returns the migrated data, or nil if
+// there was nothing to migrate.
+func migratePlaintextToken(store TokenStore) ([]byte, error) {
+	if _, ok := store.(*FileStore); ok {
+		return nil, nil
+	}
+	path, err := plaintextTokenPath()
+	if err != nil {
+		return nil, err
+	}
+	legacy := &FileStore{path}
+	data, err := legacy.Load()
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	if err = store.Save(data); err != nil {
+		return nil, fmt.Errorf("could not move saved login from %s to %s: %w", legacy.Name(), store.Name(), err)
+	}
+	if err = legacy.Delete(); err != nil {
+		slog.Warn("could not remove plaintext token after moving it", "path", path, "error", err)
+	}
+	slog.Info("moved saved login", "from", legacy.Name(), "to", store.Name())
+	return data, nil
+}
@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+	term "golang.org/x/term"
+)
+
+const (
+	ENCRYPTED_FILE_VERSION = 1
+	// scrypt parameters recommended for interactive logins
+	SCRYPT_N = 1 << 15
+	SCRYPT_R = 8
+	SCRYPT_P = 1
+
+	SALT_SIZE = 16
+	KEY_SIZE  = 32
+)
+
+var (
+	ErrWrongPassphrase = errors.New("wrong passphrase, or the token file is corrupt")
+
+	// PromptPassphrase asks the user for the passphrase protecting the saved
+	// login. confirm is set when a new passphrase is being chosen. Defaults
+	// to asking on the terminal; the TUI replaces it to keep the screen
+	// intact.
+	PromptPassphrase = ReadPassphrase
+)
+
+// encryptedFile is the on-disk format of EncryptedFileStore.
+type encryptedFile struct {
+	Version int    `json:"version"`
+	N       int    `json:"n"`
+	R       int    `json:"r"`
+	P       int    `json:"p"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// EncryptedFileStore saves the login to a file encrypted with AES-GCM, using
+// a key derived from a passphrase with scrypt. The passphrase is taken from
+// $NOTES_TOKEN_PASSPHRASE if set, or else asked for (once per run) with
+// PromptPassphrase.
+type EncryptedFileStore struct {
+	Path string
+
+	mu   sync.Mutex
+	salt []byte
+	key  []byte
+}
+
+func NewEncryptedFileStore(path string) *EncryptedFileStore {
+	return &EncryptedFileStore{Path: path}
+}
+
+func (s *EncryptedFileStore) Name() string {
+	return "encrypted file " + s.Path
+}
+
+func (s *EncryptedFileStore) Load() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	raw, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var file encryptedFile
+	if err = json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("could not read token file: %w", err)
+	}
+	if file.Version != ENCRYPTED_FILE_VERSION {
+		return nil, fmt.Errorf("unsupported token file version %d", file.Version)
+	}
+
+	key := s.key
+	if key == nil || string(file.Salt) != string(s.salt) {
+		passphrase, err := s.passphrase(false)
+		if err != nil {
+			return nil, err
+		}
+		key, err = scrypt.Key(passphrase, file.Salt, file.N, file.R, file.P, KEY_SIZE)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := gcm.Open(nil, file.Nonce, file.Data, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	s.salt, s.key = file.Salt, key
+	return data, nil
+}
+
+func (s *EncryptedFileStore) Save(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Keep using the passphrase the file was last loaded/saved with, so that
+	// refreshing the login doesn't ask again
+	if s.key == nil {
+		passphrase, err := s.passphrase(true)
+		if err != nil {
+			return err
+		}
+		salt := make([]byte, SALT_SIZE)
+		if _, err = rand.Read(salt); err != nil {
+			return err
+		}
+		key, err := scrypt.Key(passphrase, salt, SCRYPT_N, SCRYPT_R, SCRYPT_P, KEY_SIZE)
+		if err != nil {
+			return err
+		}
+		s.salt, s.key = salt, key
+	}
+
+	gcm, err := newGCM(s.key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(&encryptedFile{
+		Version: ENCRYPTED_FILE_VERSION,
+		N:       SCRYPT_N,
+		R:       SCRYPT_R,
+		P:       SCRYPT_P,
+		Salt:    s.salt,
+		Nonce:   nonce,
+		Data:    gcm.Seal(nil, nonce, data, nil),
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.Path, raw, 0600)
+}
+
+func (s *EncryptedFileStore) Delete() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.salt, s.key = nil, nil
+	err := os.Remove(s.Path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *EncryptedFileStore) passphrase(confirm bool) ([]byte, error) {
+	if env := os.Getenv("NOTES_TOKEN_PASSPHRASE"); env != "" {
+		return []byte(env), nil
+	}
+	passphrase, err := PromptPassphrase(confirm)
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) == 0 {
+		return nil, errors.New("passphrase must not be empty")
+	}
+	return passphrase, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ReadPassphrase asks for the passphrase on the controlling terminal without
+// echoing it. Works whether or not the terminal is in raw mode.
+func ReadPassphrase(confirm bool) ([]byte, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("no terminal to ask for the token passphrase on; set $NOTES_TOKEN_PASSPHRASE: %w", err)
+	}
+	defer tty.Close()
+
+	prompt := "Passphrase for saved login: "
+	if confirm {
+		prompt = "New passphrase to protect saved login: "
+	}
+	fmt.Fprint(tty, prompt)
+	passphrase, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprint(tty, "\r\n")
+	if err != nil || !confirm {
+		return passphrase, err
+	}
+
+	fmt.Fprint(tty, "Repeat passphrase: ")
+	repeated, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprint(tty, "\r\n")
+	if err != nil {
+		return nil, err
+	}
+	if string(repeated) != string(passphrase) {
+		return nil, errors.New("passphrases don't match")
+	}
+	return passphrase, nil
+}
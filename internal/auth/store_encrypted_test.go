@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// withPassphrase answers passphrase prompts with passphrase, counting them.
+func withPassphrase(t *testing.T, passphrase string) *int {
+	t.Helper()
+	t.Setenv("NOTES_TOKEN_PASSPHRASE", "")
+	prev := PromptPassphrase
+	t.Cleanup(func() { PromptPassphrase = prev })
+	prompts := 0
+	PromptPassphrase = func(confirm bool) ([]byte, error) {
+		prompts++
+		return []byte(passphrase), nil
+	}
+	return &prompts
+}
+
+func TestEncryptedFileStoreRoundTrip(t *testing.T) {
+	prompts := withPassphrase(t, "correct horse")
+	path := filepath.Join(t.TempDir(), "token.enc")
+	saved := []byte(`{"access_token":"secret-token"}`)
+
+	store := NewEncryptedFileStore(path)
+	if data, err := store.Load(); err != nil || data != nil {
+		t.Fatalf("Load() before saving = %q, %v; want nil, nil", data, err)
+	}
+	if err := store.Save(saved); err != nil {
+		t.Fatalf("Save() returned error: %v", err)
+	}
+	// Saving again, e.g. after a refresh, reuses the passphrase
+	if err := store.Save(saved); err != nil {
+		t.Fatalf("second Save() returned error: %v", err)
+	}
+	if *prompts != 1 {
+		t.Errorf("asked for the passphrase %d times while saving, want 1", *prompts)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("secret-token")) {
+		t.Error("token file contains the token in plaintext")
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("token file permissions = %v, %v; want 0600", info.Mode().Perm(), err)
+	}
+
+	// A new run has to ask again
+	data, err := NewEncryptedFileStore(path).Load()
+	if err != nil || !bytes.Equal(data, saved) {
+		t.Errorf("Load() = %q, %v; want %q", data, err, saved)
+	}
+	if *prompts != 2 {
+		t.Errorf("asked for the passphrase %d times in all, want 2", *prompts)
+	}
+
+	if err = store.Delete(); err != nil {
+		t.Fatalf("Delete() returned error: %v", err)
+	}
+	if data, err = store.Load(); err != nil || data != nil {
+		t.Errorf("Load() after deleting = %q, %v; want nil, nil", data, err)
+	}
+	if err = store.Delete(); err != nil {
+		t.Errorf("Delete() with nothing saved returned error: %v", err)
+	}
+}
+
+func TestEncryptedFileStoreWrongPassphrase(t *testing.T) {
+	withPassphrase(t, "correct horse")
+	path := filepath.Join(t.TempDir(), "token.enc")
+	if err := NewEncryptedFileStore(path).Save([]byte("data")); err != nil {
+		t.Fatalf("Save() returned error: %v", err)
+	}
+
+	withPassphrase(t, "battery staple")
+	store := NewEncryptedFileStore(path)
+	if data, err := store.Load(); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Load() with the wrong passphrase = %q, %v; want ErrWrongPassphrase", data, err)
+	}
+	// The wrong key mustn't be kept for saving later
+	if store.key != nil {
+		t.Error("kept the key from the wrong passphrase")
+	}
+}
+
+func TestEncryptedFileStoreEnvPassphrase(t *testing.T) {
+	prompts := withPassphrase(t, "unused")
+	t.Setenv("NOTES_TOKEN_PASSPHRASE", "from env")
+	path := filepath.Join(t.TempDir(), "token.enc")
+	if err := NewEncryptedFileStore(path).Save([]byte("data")); err != nil {
+		t.Fatalf("Save() returned error: %v", err)
+	}
+	if data, err := NewEncryptedFileStore(path).Load(); err != nil || string(data) != "data" {
+		t.Errorf("Load() = %q, %v; want %q", data, err, "data")
+	}
+	if *prompts != 0 {
+		t.Errorf("asked for the passphrase %d times with $NOTES_TOKEN_PASSPHRASE set", *prompts)
+	}
+}
+
+func TestEncryptedFileStoreBadFile(t *testing.T) {
+	withPassphrase(t, "correct horse")
+	dir := t.TempDir()
+	path := filepath.Join(dir, "token.enc")
+	if err := NewEncryptedFileStore(path).Save([]byte("data")); err != nil {
+		t.Fatalf("Save() returned error: %v", err)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file encryptedFile
+	if err = json.Unmarshal(raw, &file); err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := file
+	tampered.Data = append([]byte{}, file.Data...)
+	tampered.Data[0] ^= 1
+	future := file
+	future.Version = ENCRYPTED_FILE_VERSION + 1
+
+	tamperedRaw, _ := json.Marshal(tampered)
+	futureRaw, _ := json.Marshal(future)
+
+	tests := []struct {
+		name string
+		raw  []byte
+		want error
+	}{
+		{"tampered", tamperedRaw, ErrWrongPassphrase},
+		{"unsupported version", futureRaw, nil},
+		{"not JSON", []byte("not a token file"), nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, test.name)
+			if err := os.WriteFile(path, test.raw, 0600); err != nil {
+				t.Fatal(err)
+			}
+			data, err := NewEncryptedFileStore(path).Load()
+			if err == nil || (test.want != nil && !errors.Is(err, test.want)) {
+				t.Errorf("Load() = %q, %v; want error %v", data, err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	SECRET_SERVICE_NAME = "org.freedesktop.secrets"
+	SECRET_SERVICE_PATH = dbus.ObjectPath("/org/freedesktop/secrets")
+	// How long to wait for the user to answer a keyring unlock prompt
+	SECRET_SERVICE_PROMPT_TIMEOUT = 2 * time.Minute
+
+	secretServiceIface    = "org.freedesktop.Secret.Service"
+	secretCollectionIface = "org.freedesktop.Secret.Collection"
+	secretItemIface       = "org.freedesktop.Secret.Item"
+	secretSessionIface    = "org.freedesktop.Secret.Session"
+	secretPromptIface     = "org.freedesktop.Secret.Prompt"
+
+	// "/" means "no object", e.g. no prompt is needed
+	noObject = dbus.ObjectPath("/")
+)
+
+var (
+	ErrPromptDismissed = errors.New("keyring unlock was dismissed")
+)
+
+// secret is the Secret Service's (oayays) Secret struct.
+type secret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// SecretServiceStore saves the login in the freedesktop.org Secret Service
+// (GNOME Keyring, KWallet, KeePassXC, ...) over D-Bus. Logins are stored in
+// the default collection & found by their attributes, one item per profile.
+type SecretServiceStore struct {
+	conn       *dbus.Conn
+	label      string
+	attributes map[string]string
+}
+
+// NewSecretServiceStore returns a store for profile's login using the Secret
+// Service on conn, which is normally the session bus.
+func NewSecretServiceStore(conn *dbus.Conn, profile string) *SecretServiceStore {
+	return &SecretServiceStore{
+		conn:       conn,
+		label:      fmt.Sprintf("notes-term login (%s)", profile),
+		attributes: map[string]string{"application": "notes-term", "profile": profile},
+	}
+}
+
+// SecretServiceAvailable reports whether a Secret Service is running on conn,
+// or can be started on demand.
+func SecretServiceAvailable(conn *dbus.Conn) bool {
+	var hasOwner bool
+	err := conn.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, SECRET_SERVICE_NAME).Store(&hasOwner)
+	if err == nil && hasOwner {
+		return true
+	}
+	var activatable []string
+	if err = conn.BusObject().Call("org.freedesktop.DBus.ListActivatableNames", 0).Store(&activatable); err != nil {
+		return false
+	}
+	for _, name := range activatable {
+		if name == SECRET_SERVICE_NAME {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *SecretServiceStore) Name() string {
+	return "Secret Service"
+}
+
+func (s *SecretServiceStore) Load() ([]byte, error) {
+	item, err := s.findItem()
+	if err != nil || item == "" {
+		return nil, err
+	}
+
+	session, err := s.openSession()
+	if err != nil {
+		return nil, err
+	}
+	defer s.closeSession(session)
+
+	var sec secret
+	err = s.conn.Object(SECRET_SERVICE_NAME, item).Call(secretItemIface+".GetSecret", 0, session).Store(&sec)
+	if err != nil {
+		return nil, err
+	}
+	return sec.Value, nil
+}
+
+func (s *SecretServiceStore) Save(data []byte) error {
+	var collection dbus.ObjectPath
+	err := s.service().Call(secretServiceIface+".ReadAlias", 0, "default").Store(&collection)
+	if err != nil {
+		return err
+	}
+	if collection == noObject {
+		return errors.New("the Secret Service has no default collection")
+	}
+	if err = s.unlock([]dbus.ObjectPath{collection}); err != nil {
+		return err
+	}
+
+	session, err := s.openSession()
+	if err != nil {
+		return err
+	}
+	defer s.closeSession(session)
+
+	properties := map[string]dbus.Variant{
+		"org.freedesktop.Secret.Item.Label":      dbus.MakeVariant(s.label),
+		"org.freedesktop.Secret.Item.Attributes": dbus.MakeVariant(s.attributes),
+	}
+	sec := secret{session, []byte{}, data, "application/json"}
+	var item, prompt dbus.ObjectPath
+	err = s.conn.Object(SECRET_SERVICE_NAME, collection).Call(secretCollectionIface+".CreateItem", 0, properties, sec, true).Store(&item, &prompt)
+	if err != nil {
+		return err
+	}
+	return s.prompt(prompt)
+}
+
+func (s *SecretServiceStore) Delete() error {
+	item, err := s.findItem()
+	if err != nil || item == "" {
+		return err
+	}
+
+	var prompt dbus.ObjectPath
+	err = s.conn.Object(SECRET_SERVICE_NAME, item).Call(secretItemIface+".Delete", 0).Store(&prompt)
+	if err != nil {
+		return err
+	}
+	return s.prompt(prompt)
+}
+
+func (s *SecretServiceStore) service() dbus.BusObject {
+	return s.conn.Object(SECRET_SERVICE_NAME, SECRET_SERVICE_PATH)
+}
+
+// openSession opens a session for transferring secrets. The "plain" algorithm
+// is used since secrets never leave the local bus.
+func (s *SecretServiceStore) openSession() (dbus.ObjectPath, error) {
+	var output dbus.Variant
+	var session dbus.ObjectPath
+	err := s.service().Call(secretServiceIface+".OpenSession", 0, "plain", dbus.MakeVariant("")).Store(&output, &session)
+	return session, err
+}
+
+func (s *SecretServiceStore) closeSession(session dbus.ObjectPath) {
+	s.conn.Object(SECRET_SERVICE_NAME, session).Call(secretSessionIface+".Close", 0)
+}
+
+// findItem returns this profile's item, unlocking it if needed, or "" if
+// there is none.
+func (s *SecretServiceStore) findItem() (dbus.ObjectPath, error) {
+	var unlocked, locked []dbus.ObjectPath
+	err := s.service().Call(secretServiceIface+".SearchItems", 0, s.attributes).Store(&unlocked, &locked)
+	if err != nil {
+		return "", err
+	}
+	if len(unlocked) > 0 {
+		return unlocked[0], nil
+	}
+	if len(locked) > 0 {
+		return locked[0], s.unlock(locked[:1])
+	}
+	return "", nil
+}
+
+func (s *SecretServiceStore) unlock(objects []dbus.ObjectPath) error {
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	err := s.service().Call(secretServiceIface+".Unlock", 0, objects).Store(&unlocked, &prompt)
+	if err != nil {
+		return err
+	}
+	return s.prompt(prompt)
+}
+
+// prompt shows a prompt returned by the Secret Service, e.g. to unlock the
+// keyring, & waits for the user to complete it.
+func (s *SecretServiceStore) prompt(prompt dbus.ObjectPath) error {
+	if prompt == "" || prompt == noObject {
+		return nil
+	}
+
+	match := []dbus.MatchOption{
+		dbus.WithMatchObjectPath(prompt),
+		dbus.WithMatchInterface(secretPromptIface),
+		dbus.WithMatchMember("Completed"),
+	}
+	if err := s.conn.AddMatchSignal(match...); err != nil {
+		return err
+	}
+	defer s.conn.RemoveMatchSignal(match...)
+	signals := make(chan *dbus.Signal, 1)
+	s.conn.Signal(signals)
+	defer s.conn.RemoveSignal(signals)
+
+	err := s.conn.Object(SECRET_SERVICE_NAME, prompt).Call(secretPromptIface+".Prompt", 0, "").Err
+	if err != nil {
+		return err
+	}
+
+	timeout := time.After(SECRET_SERVICE_PROMPT_TIMEOUT)
+	for {
+		select {
+		case signal := <-signals:
+			if signal.Path != prompt || signal.Name != secretPromptIface+".Completed" {
+				continue
+			}
+			if len(signal.Body) > 0 && signal.Body[0] == true {
+				return ErrPromptDismissed
+			}
+			return nil
+		case <-timeout:
+			return errors.New("timed out waiting for the keyring to be unlocked")
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package auth
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const testBusConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:dir=%s</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`
+
+// privateBus starts a bus daemon of its own for the test & returns its
+// address.
+func privateBus(t *testing.T) string {
+	t.Helper()
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon isn't installed")
+	}
+	dir := t.TempDir()
+	config := filepath.Join(dir, "bus.conf")
+	if err = os.WriteFile(config, []byte(fmt.Sprintf(testBusConfig, dir)), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(daemon, "--config-file="+config, "--nofork", "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.Start(); err != nil {
+		t.Fatalf("could not start dbus-daemon: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("could not read bus address: %v", err)
+	}
+	return strings.TrimSpace(address)
+}
+
+func connect(t *testing.T, address string) *dbus.Conn {
+	t.Helper()
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatalf("could not connect to bus: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// fakeSecretService is an in-memory Secret Service with a single default
+// collection, which may start out locked.
+type fakeSecretService struct {
+	conn *dbus.Conn
+
+	mu         sync.Mutex
+	locked     bool
+	dismiss    bool // Whether unlock prompts are dismissed
+	items      map[dbus.ObjectPath]*fakeItem
+	sessions   map[dbus.ObjectPath]bool
+	nextID     int
+	unlockAsks int
+}
+
+const fakeCollection = dbus.ObjectPath("/org/freedesktop/secrets/collection/login")
+
+func newFakeSecretService(t *testing.T, conn *dbus.Conn, locked bool) *fakeSecretService {
+	t.Helper()
+	service := &fakeSecretService{
+		conn:     conn,
+		locked:   locked,
+		items:    map[dbus.ObjectPath]*fakeItem{},
+		sessions: map[dbus.ObjectPath]bool{},
+	}
+	if err := conn.Export(service, SECRET_SERVICE_PATH, secretServiceIface); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Export(&fakeCollectionObject{service}, fakeCollection, secretCollectionIface); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := conn.RequestName(SECRET_SERVICE_NAME, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("could not own %s: %v", SECRET_SERVICE_NAME, err)
+	}
+	return service
+}
+
+func (s *fakeSecretService) newPath(kind string) dbus.ObjectPath {
+	s.nextID++
+	return dbus.ObjectPath(fmt.Sprintf("/org/freedesktop/secrets/%s/%d", kind, s.nextID))
+}
+
+func (s *fakeSecretService) OpenSession(algorithm string, input dbus.Variant) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+	if algorithm != "plain" {
+		return dbus.Variant{}, "", dbus.MakeFailedError(errors.New("unsupported algorithm"))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := s.newPath("session")
+	s.sessions[path] = true
+	s.conn.Export(&fakeSession{s, path}, path, secretSessionIface)
+	return dbus.MakeVariant(""), path, nil
+}
+
+func (s *fakeSecretService) SearchItems(attributes map[string]string) ([]dbus.ObjectPath, []dbus.ObjectPath, *dbus.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	found := []dbus.ObjectPath{}
+	for path, item := range s.items {
+		if item.matches(attributes) {
+			found = append(found, path)
+		}
+	}
+	if s.locked {
+		return []dbus.ObjectPath{}, found, nil
+	}
+	return found, []dbus.ObjectPath{}, nil
+}
+
+func (s *fakeSecretService) Unlock(objects []dbus.ObjectPath) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.locked {
+		return objects, noObject, nil
+	}
+	s.unlockAsks++
+	path := s.newPath("prompt")
+	s.conn.Export(&fakePrompt{s, path, objects}, path, secretPromptIface)
+	return []dbus.ObjectPath{}, path, nil
+}
+
+func (s *fakeSecretService) ReadAlias(name string) (dbus.ObjectPath, *dbus.Error) {
+	if name == "default" {
+		return fakeCollection, nil
+	}
+	return noObject, nil
+}
+
+type fakeCollectionObject struct {
+	service *fakeSecretService
+}
+
+func (c *fakeCollectionObject) CreateItem(properties map[string]dbus.Variant, sec secret, replace bool) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	s := c.service
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.locked {
+		return "", "", dbus.NewError("org.freedesktop.Secret.Error.IsLocked", nil)
+	}
+	if !s.sessions[sec.Session] {
+		return "", "", dbus.NewError("org.freedesktop.Secret.Error.NoSession", nil)
+	}
+	attributes, ok := properties[secretItemIface+".Attributes"].Value().(map[string]string)
+	if !ok {
+		return "", "", dbus.MakeFailedError(errors.New("missing attributes"))
+	}
+
+	if replace {
+		for path, item := range s.items {
+			if item.matches(attributes) {
+				item.value = sec.Value
+				return path, noObject, nil
+			}
+		}
+	}
+	path := s.newPath("collection/login/item")
+	item := &fakeItem{s, path, attributes, sec.Value}
+	s.items[path] = item
+	s.conn.Export(item, path, secretItemIface)
+	return path, noObject, nil
+}
+
+type fakeItem struct {
+	service    *fakeSecretService
+	path       dbus.ObjectPath
+	attributes map[string]string
+	value      []byte
+}
+
+func (item *fakeItem) matches(attributes map[string]string) bool {
+	for k, v := range attributes {
+		if item.attributes[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (item *fakeItem) GetSecret(session dbus.ObjectPath) (secret, *dbus.Error) {
+	s := item.service
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.locked {
+		return secret{}, dbus.NewError("org.freedesktop.Secret.Error.IsLocked", nil)
+	}
+	if !s.sessions[session] {
+		return secret{}, dbus.NewError("org.freedesktop.Secret.Error.NoSession", nil)
+	}
+	return secret{session, []byte{}, item.value, "application/json"}, nil
+}
+
+func (item *fakeItem) Delete() (dbus.ObjectPath, *dbus.Error) {
+	s := item.service
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, item.path)
+	s.conn.Export(nil, item.path, secretItemIface)
+	return noObject, nil
+}
+
+type fakeSession struct {
+	service *fakeSecretService
+	path    dbus.ObjectPath
+}
+
+func (session *fakeSession) Close() *dbus.Error {
+	s := session.service
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, session.path)
+	s.conn.Export(nil, session.path, secretSessionIface)
+	return nil
+}
+
+type fakePrompt struct {
+	service *fakeSecretService
+	path    dbus.ObjectPath
+	objects []dbus.ObjectPath
+}
+
+func (p *fakePrompt) Prompt(windowID string) *dbus.Error {
+	s := p.service
+	s.mu.Lock()
+	dismissed := s.dismiss
+	if !dismissed {
+		s.locked = false
+	}
+	s.mu.Unlock()
+
+	go s.conn.Emit(p.path, secretPromptIface+".Completed", dismissed, dbus.MakeVariant(p.objects))
+	return nil
+}
+
+func TestSecretServiceStore(t *testing.T) {
+	address := privateBus(t)
+	serviceConn, conn := connect(t, address), connect(t, address)
+	if SecretServiceAvailable(conn) {
+		t.Error("SecretServiceAvailable() = true before the service has started")
+	}
+	service := newFakeSecretService(t, serviceConn, false)
+	if !SecretServiceAvailable(conn) {
+		t.Error("SecretServiceAvailable() = false with the service running")
+	}
+
+	store, other := NewSecretServiceStore(conn, "default"), NewSecretServiceStore(conn, "work")
+	if data, err := store.Load(); err != nil || data != nil {
+		t.Fatalf("Load() before saving = %q, %v; want nil, nil", data, err)
+	}
+
+	for _, saved := range []string{`{"access_token":"one"}`, `{"access_token":"two"}`} {
+		if err := store.Save([]byte(saved)); err != nil {
+			t.Fatalf("Save() returned error: %v", err)
+		}
+		data, err := store.Load()
+		if err != nil || string(data) != saved {
+			t.Fatalf("Load() = %q, %v; want %q", data, err, saved)
+		}
+	}
+	service.mu.Lock()
+	items := len(service.items)
+	service.mu.Unlock()
+	if items != 1 {
+		t.Errorf("saving twice left %d items, want 1", items)
+	}
+
+	if err := other.Save([]byte("other")); err != nil {
+		t.Fatalf("Save() for another profile returned error: %v", err)
+	}
+	if err := store.Delete(); err != nil {
+		t.Fatalf("Delete() returned error: %v", err)
+	}
+	if data, err := store.Load(); err != nil || data != nil {
+		t.Errorf("Load() after deleting = %q, %v; want nil, nil", data, err)
+	}
+	if err := store.Delete(); err != nil {
+		t.Errorf("Delete() with nothing saved returned error: %v", err)
+	}
+	if data, err := other.Load(); err != nil || string(data) != "other" {
+		t.Errorf("Load() for the other profile = %q, %v; want %q", data, err, "other")
+	}
+
+	service.mu.Lock()
+	open := len(service.sessions)
+	service.mu.Unlock()
+	if open != 0 {
+		t.Errorf("%d sessions left open", open)
+	}
+}
+
+func TestSecretServiceStoreLocked(t *testing.T) {
+	address := privateBus(t)
+	serviceConn, conn := connect(t, address), connect(t, address)
+	service := newFakeSecretService(t, serviceConn, true)
+	store := NewSecretServiceStore(conn, "default")
+
+	service.mu.Lock()
+	service.dismiss = true
+	service.mu.Unlock()
+	if err := store.Save([]byte("data")); !errors.Is(err, ErrPromptDismissed) {
+		t.Errorf("Save() with the unlock dismissed = %v, want ErrPromptDismissed", err)
+	}
+
+	service.mu.Lock()
+	service.dismiss = false
+	service.mu.Unlock()
+	if err := store.Save([]byte("data")); err != nil {
+		t.Fatalf("Save() unlocking the collection returned error: %v", err)
+	}
+
+	service.mu.Lock()
+	service.locked = true
+	service.mu.Unlock()
+	if data, err := store.Load(); err != nil || string(data) != "data" {
+		t.Errorf("Load() unlocking the item = %q, %v; want %q", data, err, "data")
+	}
+	service.mu.Lock()
+	asks := service.unlockAsks
+	service.mu.Unlock()
+	if asks != 3 {
+		t.Errorf("asked to unlock %d times, want 3", asks)
+	}
+}
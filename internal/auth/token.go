@@ -1,72 +1,163 @@
 package auth
 
 import (
+	"context"
 	"encoding/json"
-	"io"
+	"errors"
+	"fmt"
 	"log/slog"
-	"os"
-	"path/filepath"
+	"sync"
 	"time"
 
 	"golang.org/x/oauth2"
-	"mrshanahan.com/notes-term/internal/paths"
+)
+
+var (
+	ErrNoRefreshToken = errors.New("no refresh token available")
 )
 
 // var (
 // 	Cache *TokenCache // = newTokenCache()
 // )
 
+// storedToken is the on-disk form of a token. The ID token is kept alongside
+// the OAuth token, which doesn't serialize its extra fields.
+type storedToken struct {
+	*oauth2.Token
+	IDToken string `json:"id_token,omitempty"`
+}
+
+// LoadToken returns the saved token for the active profile, or an empty
+// token if there is none.
 func LoadToken() (*oauth2.Token, error) {
-	cacheDir, err := paths.EnsureLocalCacheFolder()
+	data, err := tokenStore.Load()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("could not load token from %s: %w", tokenStore.Name(), err)
 	}
-	cacheFile := filepath.Join(cacheDir, "token")
-
-	var token *oauth2.Token
-	if _, err = os.Stat(cacheFile); err != nil && os.IsNotExist(err) {
-		slog.Info("no token file")
+	if data == nil {
+		data, err = migratePlaintextToken(tokenStore)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if data == nil {
+		slog.Info("no saved token", "store", tokenStore.Name())
 		return &oauth2.Token{}, nil
 	}
 
-	f, err := os.Open(cacheFile)
+	stored := &storedToken{Token: &oauth2.Token{}}
+	err = json.Unmarshal(data, stored)
 	if err != nil {
 		return nil, err
 	}
 
-	bytes, err := io.ReadAll(f)
-	if err != nil {
-		return nil, err
+	if stored.IDToken != "" {
+		return stored.Token.WithExtra(map[string]interface{}{"id_token": stored.IDToken}), nil
 	}
-
-	err = json.Unmarshal(bytes, token)
-	if err != nil {
-		return nil, err
-	}
-
-	return token, nil
+	return stored.Token, nil
 }
 
+// SaveToken saves t as the active profile's login.
 func SaveToken(t *oauth2.Token) error {
-	cacheDir, err := paths.EnsureLocalCacheFolder()
+	return saveToken(tokenStore, t)
+}
+
+func saveToken(store TokenStore, t *oauth2.Token) error {
+	data, err := json.Marshal(&storedToken{t, IDToken(t)})
 	if err != nil {
 		return err
 	}
-	cacheFile := filepath.Join(cacheDir, "token")
+	return store.Save(data)
+}
 
-	bytes, err := json.Marshal(t)
+// DeleteToken removes the saved token, if any.
+func DeleteToken() error {
+	return tokenStore.Delete()
+}
+
+// IDToken returns the raw OIDC ID token that came with t, or "" if none.
+func IDToken(t *oauth2.Token) string {
+	idToken, _ := t.Extra("id_token").(string)
+	return idToken
+}
+
+// TokenSource hands out tokens for API requests, refreshing them when they
+// expire & saving them whenever they change, e.g. when a refresh rotates the
+// access or refresh token.
+type TokenSource struct {
+	config *oauth2.Config
+	// Where the profile the source was created for keeps its login, which
+	// stays put if another profile becomes active
+	store  TokenStore
+	mu     sync.Mutex
+	source oauth2.TokenSource
+	last   *oauth2.Token
+}
+
+// NewTokenSource returns a token source starting from token, using the
+// provider & token store set up by InitializeAuth.
+func NewTokenSource(token *oauth2.Token) *TokenSource {
+	config := &clientAuthConfig.KeycloakLoginConfig
+	return &TokenSource{config: config, store: tokenStore, source: config.TokenSource(context.Background(), token), last: token}
+}
+
+func (s *TokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, err := s.source.Token()
 	if err != nil {
-		return err
+		return nil, err
 	}
+	s.remember(token)
+	return token, nil
+}
 
-	err = os.WriteFile(cacheFile, bytes, 0600)
+// Refresh gets a new access token using the refresh token, regardless of
+// whether the current access token has expired.
+func (s *TokenSource) Refresh() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.last == nil || s.last.RefreshToken == "" {
+		return ErrNoRefreshToken
+	}
+	// Without an access token the token is considered expired & refreshed
+	expired := &oauth2.Token{RefreshToken: s.last.RefreshToken}
+	source := s.config.TokenSource(context.Background(), expired)
+	token, err := source.Token()
 	if err != nil {
 		return err
 	}
-
+	s.source = source
+	s.remember(token)
 	return nil
 }
 
+// Set replaces the current token, e.g. after logging in again.
+func (s *TokenSource) Set(token *oauth2.Token) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.source = s.config.TokenSource(context.Background(), token)
+	s.remember(token)
+}
+
+// remember saves token if it differs from the last one seen. Caller must hold
+// s.mu.
+func (s *TokenSource) remember(token *oauth2.Token) {
+	// Refreshes don't always come with a new ID token; keep the old one
+	if IDToken(token) == "" && s.last != nil && IDToken(s.last) != "" {
+		token = token.WithExtra(map[string]interface{}{"id_token": IDToken(s.last)})
+	}
+	if s.last == nil || token.AccessToken != s.last.AccessToken || token.RefreshToken != s.last.RefreshToken {
+		if err := saveToken(s.store, token); err != nil {
+			slog.Warn("could not save token", "error", err)
+		}
+		s.last = token
+	}
+}
+
 func IsValid(t *oauth2.Token) bool {
 	return t.AccessToken != "" && t.Expiry.After(time.Now())
 }
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// withProfile makes a profile active the way InitializeAuth would, with its
+// token endpoint at tokenURL & its login saved in a file under dir. The
+// previous state is put back after the test.
+func withProfile(t *testing.T, tokenURL string, dir string) *FileStore {
+	t.Helper()
+	t.Cleanup(SaveState())
+	store := &FileStore{Path: filepath.Join(dir, "token")}
+	clientAuthConfig = &Config{KeycloakLoginConfig: oauth2.Config{
+		ClientID: "notes-cli",
+		Endpoint: oauth2.Endpoint{TokenURL: tokenURL, AuthStyle: oauth2.AuthStyleInParams},
+	}}
+	tokenStore = store
+	return store
+}
+
+// newTokenServer serves a token endpoint that hands out a new access token
+// prefixed with name for each refresh.
+func newTokenServer(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+	refreshes := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "refresh_token" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		refreshes++
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  fmt.Sprintf("%s-access-%d", name, refreshes),
+			"refresh_token": fmt.Sprintf("%s-refresh-%d", name, refreshes),
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func loadStored(t *testing.T, store TokenStore) *oauth2.Token {
+	t.Helper()
+	data, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if data == nil {
+		return nil
+	}
+	stored := &storedToken{Token: &oauth2.Token{}}
+	if err := json.Unmarshal(data, stored); err != nil {
+		t.Fatal(err)
+	}
+	return stored.Token
+}
+
+func TestTokenSourceRefreshSaves(t *testing.T) {
+	server := newTokenServer(t, "work")
+	store := withProfile(t, server.URL, t.TempDir())
+
+	tokens := NewTokenSource(&oauth2.Token{AccessToken: "old", RefreshToken: "r", Expiry: time.Now().Add(-time.Minute)})
+	if err := tokens.Refresh(); err != nil {
+		t.Fatalf("Refresh() returned error: %v", err)
+	}
+	if saved := loadStored(t, store); saved == nil || saved.AccessToken != "work-access-1" || saved.RefreshToken != "work-refresh-1" {
+		t.Errorf("saved token = %+v, want the refreshed one", saved)
+	}
+}
+
+func TestTokenSourceRefreshAfterProfileSwitch(t *testing.T) {
+	workServer, homeServer := newTokenServer(t, "work"), newTokenServer(t, "home")
+	workStore := withProfile(t, workServer.URL, t.TempDir())
+	expired := time.Now().Add(-time.Minute)
+	workTokens := NewTokenSource(&oauth2.Token{AccessToken: "work", RefreshToken: "r", Expiry: expired})
+
+	homeStore := withProfile(t, homeServer.URL, t.TempDir())
+	homeLogin := &oauth2.Token{AccessToken: "home", RefreshToken: "home-refresh", Expiry: time.Now().Add(time.Hour)}
+	if err := SaveToken(homeLogin); err != nil {
+		t.Fatal(err)
+	}
+
+	// E.g. a request still in flight on the old profile's client
+	if err := workTokens.Refresh(); err != nil {
+		t.Fatalf("Refresh() returned error: %v", err)
+	}
+	token, err := workTokens.Token()
+	if err != nil || token.AccessToken != "work-access-1" {
+		t.Errorf("Token() = %+v, %v; want the token refreshed by the old profile's provider", token, err)
+	}
+	if saved := loadStored(t, workStore); saved == nil || saved.AccessToken != "work-access-1" {
+		t.Errorf("old profile's saved token = %+v, want the refreshed one", saved)
+	}
+	if saved := loadStored(t, homeStore); saved == nil || saved.AccessToken != homeLogin.AccessToken {
+		t.Errorf("new profile's saved token = %+v, want its own login", saved)
+	}
+}
@@ -0,0 +1,418 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"mrshanahan.com/notes-term/internal/editor"
+	"mrshanahan.com/notes-term/internal/paths"
+)
+
+const (
+	DEFAULT_API_URL    = "https://notes.quemot.dev/"
+	DEFAULT_ISSUER_URL = "https://auth.notes.quemot.dev/realms/notes"
+	DEFAULT_CLIENT_ID  = "notes-cli"
+
+	// Where the login is saved; see Config.TokenStore
+	TOKEN_STORE_AUTO           = "auto"
+	TOKEN_STORE_SECRET_SERVICE = "secret-service"
+	TOKEN_STORE_ENCRYPTED_FILE = "encrypted-file"
+	TOKEN_STORE_FILE           = "file"
+
+	// How to log in; see Config.LoginFlow
+	LOGIN_FLOW_AUTO    = "auto"
+	LOGIN_FLOW_BROWSER = "browser"
+	LOGIN_FLOW_DEVICE  = "device"
+)
+
+var (
+	DefaultScopes = []string{"openid", "profile", "email"}
+	TokenStores   = []string{TOKEN_STORE_AUTO, TOKEN_STORE_SECRET_SERVICE, TOKEN_STORE_ENCRYPTED_FILE, TOKEN_STORE_FILE}
+	LoginFlows    = []string{LOGIN_FLOW_AUTO, LOGIN_FLOW_BROWSER, LOGIN_FLOW_DEVICE}
+)
+
+// Config is where to find the notes API & how to log in to it, for a single
+// profile. Values come from, in increasing order of precedence: the
+// defaults, the config file, NOTES_* environment variables & command-line
+// flags.
+type Config struct {
+	// Name of the profile these settings belong to
+	Profile string `toml:"-"`
+
+	APIURL    string   `toml:"api_url"`
+	IssuerURL string   `toml:"issuer_url"`
+	ClientID  string   `toml:"client_id"`
+	Scopes    []string `toml:"scopes"`
+	// One of TokenStores. "auto" uses the Secret Service if it's running &
+	// an encrypted file otherwise; "file" (plaintext) must be chosen
+	// explicitly.
+	TokenStore string `toml:"token_store"`
+	// One of LoginFlows. "browser" is the authorization code flow with PKCE
+	// via a loopback redirect; "auto" uses it when a browser can be opened
+	// & the device flow otherwise.
+	LoginFlow string `toml:"login_flow"`
+
+	// Editor command, e.g. "code --wait {path}"; see editor.Parse. If
+	// empty, $VISUAL or $EDITOR is used.
+	Editor string `toml:"editor"`
+	// Flags passed to the editor when viewing read-only, if the defaults for
+	// known editors aren't right
+	EditorReadOnlyFlags string `toml:"editor_readonly_flags"`
+	// Order of the note list, one of SortOrders
+	Sort SortOrder `toml:"sort"`
+	// Whether moving up from the first note selects the last & vice versa
+	WrapSelection bool `toml:"wrap_selection"`
+	// Keys for UI commands, by command name, replacing their default keys
+	Keys   map[string]KeyList `toml:"keys"`
+	Colors Colors             `toml:"colors"`
+}
+
+// File is a parsed config file. Top-level settings make up the default
+// profile; named profiles are [profiles.<name>] tables, which inherit any
+// top-level settings they don't set themselves:
+//
+//	api_url = "https://notes.example.com/"
+//	profile = "work"                      # used when --profile isn't given
+//
+//	[profiles.work]
+//	api_url    = "https://notes.work.example.com/"
+//	issuer_url = "https://auth.work.example.com/realms/notes"
+type File struct {
+	Path string
+	// Profile to use when none is given
+	DefaultProfile string
+
+	base     Config
+	profiles map[string]*Config
+	// Line each key is set on; see keyLines
+	lines map[string]int
+}
+
+// fileContents is the raw layout of the config file.
+type fileContents struct {
+	Config
+	Profile  string                    `toml:"profile"`
+	Profiles map[string]toml.Primitive `toml:"profiles"`
+}
+
+var profileNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func Default() *Config {
+	return &Config{
+		Profile:   paths.DEFAULT_PROFILE,
+		APIURL:    DEFAULT_API_URL,
+		IssuerURL: DEFAULT_ISSUER_URL,
+		ClientID:  DEFAULT_CLIENT_ID,
+		Scopes:    append([]string{}, DefaultScopes...),
+
+		TokenStore: TOKEN_STORE_AUTO,
+		LoginFlow:  LOGIN_FLOW_AUTO,
+
+		Sort:          SORT_SERVER,
+		WrapSelection: true,
+		Keys:          map[string]KeyList{},
+		Colors:        defaultColors(),
+	}
+}
+
+// clone returns a copy of cfg that shares nothing with it.
+func (cfg *Config) clone() *Config {
+	copied := *cfg
+	copied.Scopes = slices.Clone(cfg.Scopes)
+	copied.Keys = map[string]KeyList{}
+	for action, keys := range cfg.Keys {
+		copied.Keys[action] = slices.Clone(keys)
+	}
+	return &copied
+}
+
+// DefaultPath returns the config file used when none is given.
+func DefaultPath() string {
+	return filepath.Join(paths.ConfigDir(), "config.toml")
+}
+
+// Load reads the config file & returns the settings for the given profile
+// with the environment applied. If path is empty, $NOTES_CONFIG or
+// DefaultPath() is used; the default file not existing is not an error. If
+// profile is empty, $NOTES_PROFILE or the file's default profile is used.
+func Load(path string, profile string) (*File, *Config, error) {
+	file, err := LoadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if profile == "" {
+		profile = os.Getenv("NOTES_PROFILE")
+	}
+	if profile == "" {
+		profile = file.DefaultProfile
+	}
+	cfg, err := file.Profile(profile)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg.applyEnv()
+	return file, cfg, nil
+}
+
+// LoadFile reads & checks the config file at path; see Load.
+func LoadFile(path string) (*File, error) {
+	explicit := path != ""
+	if !explicit {
+		path = os.Getenv("NOTES_CONFIG")
+		explicit = path != ""
+	}
+	if !explicit {
+		path = DefaultPath()
+	}
+
+	file := &File{Path: path, DefaultProfile: paths.DEFAULT_PROFILE, base: *Default(), profiles: map[string]*Config{}}
+	if err := file.load(); err != nil {
+		if explicit || !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return file, nil
+}
+
+func (file *File) load() error {
+	data, err := os.ReadFile(file.Path)
+	if err != nil {
+		return fmt.Errorf("could not read config file: %w", err)
+	}
+	contents := fileContents{Config: file.base}
+	meta, err := toml.Decode(string(data), &contents)
+	if err != nil {
+		return file.decodeError("", err)
+	}
+	file.lines = keyLines(string(data))
+
+	file.base = contents.Config
+	file.base.Profile = paths.DEFAULT_PROFILE
+	if err := file.validate(&file.base); err != nil {
+		return err
+	}
+	names := []string{}
+	for name := range contents.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !profileNameRegexp.MatchString(name) || name == paths.DEFAULT_PROFILE {
+			return file.Errorf("", []string{"profiles", name}, "invalid profile name '%s'", name)
+		}
+		cfg := file.base.clone()
+		if err := meta.PrimitiveDecode(contents.Profiles[name], cfg); err != nil {
+			return file.decodeError(name, err)
+		}
+		cfg.Profile = name
+		if err := file.validate(cfg); err != nil {
+			return err
+		}
+		file.profiles[name] = cfg
+	}
+
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		return file.Errorf("", undecoded[0], "unknown setting '%s'", undecoded[0])
+	}
+	if contents.Profile != "" {
+		if _, err := file.Profile(contents.Profile); err != nil {
+			return file.Errorf("", []string{"profile"}, "%w", err)
+		}
+		file.DefaultProfile = contents.Profile
+	}
+	return nil
+}
+
+// validate checks the settings for a profile as given in the file.
+func (file *File) validate(cfg *Config) error {
+	err := cfg.Validate()
+	var settingErr *SettingError
+	if errors.As(err, &settingErr) {
+		return file.Errorf(cfg.Profile, []string{settingErr.Key}, "%w", err)
+	}
+	return err
+}
+
+// tomlErrorRegexp matches how the toml package starts its errors, e.g.
+// `toml: line 3 (last key "sort"): `.
+var tomlErrorRegexp = regexp.MustCompile(`^toml: (?:line (\d+) ?)?(?:\(last key "((?:[^"\\]|\\.)*)"\))?:? ?`)
+
+// decodeError returns a parse or type error from the toml package for the
+// given profile, placed at the line it's on.
+func (file *File) decodeError(profile string, err error) error {
+	msg, line := err.Error(), 0
+	if m := tomlErrorRegexp.FindStringSubmatch(msg); m != nil {
+		msg = msg[len(m[0]):]
+		line, _ = strconv.Atoi(m[1])
+		if key, _ := strconv.Unquote(`"` + m[2] + `"`); line == 0 && key != "" {
+			line = lineOf(file.lines, strings.Split(key, ".")...)
+		}
+	}
+	return file.errorAt(line, profile, "%s", msg)
+}
+
+// Errorf returns an error about the setting key in the given profile (""
+// for settings outside any profile), starting with the path of the file &
+// the line the setting is on, e.g. "config.toml:3: invalid key 'x'". A
+// profile's settings are looked for in its own table, then at the top
+// level, where it inherits them from.
+func (file *File) Errorf(profile string, key []string, format string, args ...any) error {
+	return file.errorAt(file.line(profile, key), profile, format, args...)
+}
+
+// line returns the line the setting key in the given profile is set on; see
+// Errorf.
+func (file *File) line(profile string, key []string) int {
+	keys := [][]string{key}
+	if profile != "" && profile != paths.DEFAULT_PROFILE {
+		keys = [][]string{append([]string{"profiles", profile}, key...), key}
+	}
+	for _, k := range keys {
+		if line, ok := file.lines[strings.Join(k, ".")]; ok {
+			return line
+		}
+	}
+	// Set inline, e.g. in keys = { down = "j" }
+	for _, k := range keys {
+		if line := lineOf(file.lines, k...); line > 0 {
+			return line
+		}
+	}
+	return 0
+}
+
+func (file *File) errorAt(line int, profile string, format string, args ...any) error {
+	prefix := file.Path + ":"
+	if line > 0 {
+		prefix += strconv.Itoa(line) + ":"
+	}
+	if profile != "" && profile != paths.DEFAULT_PROFILE {
+		prefix += fmt.Sprintf(" profile '%s':", profile)
+	}
+	return fmt.Errorf(prefix+" "+format, args...)
+}
+
+// ProfileNames returns the default profile followed by the named profiles in
+// alphabetical order.
+func (file *File) ProfileNames() []string {
+	names := []string{}
+	for name := range file.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append([]string{paths.DEFAULT_PROFILE}, names...)
+}
+
+// Profile returns the settings for the named profile as given in the file,
+// without the environment applied.
+func (file *File) Profile(name string) (*Config, error) {
+	if name == "" || name == paths.DEFAULT_PROFILE {
+		return file.base.clone(), nil
+	}
+	cfg, ok := file.profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile '%s'", name)
+	}
+	return cfg.clone(), nil
+}
+
+func (cfg *Config) applyEnv() {
+	if v := os.Getenv("NOTES_API_URL"); v != "" {
+		cfg.APIURL = v
+	}
+	if v := os.Getenv("NOTES_ISSUER_URL"); v != "" {
+		cfg.IssuerURL = v
+	}
+	if v := os.Getenv("NOTES_CLIENT_ID"); v != "" {
+		cfg.ClientID = v
+	}
+	if v := os.Getenv("NOTES_SCOPES"); v != "" {
+		cfg.Scopes = ParseScopes(v)
+	}
+	if v := os.Getenv("NOTES_TOKEN_STORE"); v != "" {
+		cfg.TokenStore = v
+	}
+	if v := os.Getenv("NOTES_LOGIN_FLOW"); v != "" {
+		cfg.LoginFlow = v
+	}
+}
+
+// ParseScopes splits a space- or comma-separated list of scopes.
+func ParseScopes(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+}
+
+// SettingError is an invalid setting found by Validate.
+type SettingError struct {
+	// Name of the setting in the config file, e.g. "api_url"
+	Key string
+	Err error
+}
+
+func (e *SettingError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *SettingError) Unwrap() error {
+	return e.Err
+}
+
+func settingError(key string, err error) error {
+	return &SettingError{key, err}
+}
+
+// Validate checks that the settings are usable, so that mistakes are reported
+// up front rather than as failed requests. Invalid settings are reported as a
+// *SettingError.
+func (cfg *Config) Validate() error {
+	if err := validateURL("API URL", cfg.APIURL); err != nil {
+		return settingError("api_url", err)
+	}
+	if err := validateURL("issuer URL", cfg.IssuerURL); err != nil {
+		return settingError("issuer_url", err)
+	}
+	if strings.TrimSpace(cfg.ClientID) == "" {
+		return settingError("client_id", errors.New("client ID must not be empty"))
+	}
+	if !slices.Contains(TokenStores, cfg.TokenStore) {
+		return settingError("token_store", fmt.Errorf("invalid token store '%s': must be one of %s", cfg.TokenStore, strings.Join(TokenStores, ", ")))
+	}
+	if !slices.Contains(LoginFlows, cfg.LoginFlow) {
+		return settingError("login_flow", fmt.Errorf("invalid login flow '%s': must be one of %s", cfg.LoginFlow, strings.Join(LoginFlows, ", ")))
+	}
+	if !slices.Contains(cfg.Scopes, "openid") {
+		return settingError("scopes", errors.New("scopes must include 'openid'"))
+	}
+	if cfg.Editor != "" {
+		if _, err := editor.Parse(cfg.Editor); err != nil {
+			return settingError("editor", fmt.Errorf("invalid editor '%s': %w", cfg.Editor, err))
+		}
+	}
+	if !slices.Contains(SortOrders, string(cfg.Sort)) {
+		return settingError("sort", fmt.Errorf("invalid sort order '%s': must be one of %s", cfg.Sort, strings.Join(SortOrders, ", ")))
+	}
+	return nil
+}
+
+func validateURL(name string, value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s '%s': %w", name, value, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid %s '%s': must be an http(s) URL", name, value)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestKeyLines(t *testing.T) {
+	data := `# A comment
+api_url = "https://notes.example.com/" # trailing comment
+scopes = [
+  "openid",
+  "profile",
+]
+editor = """
+vim
+"""
+"quoted.key" = 'x'
+sort = "title"
+
+[keys]
+down = ["j", "ctrl+n"]
+up = { not = "a real key" }
+
+[profiles.work]
+colors.default.background = "red"
+
+[profiles."my-home" ]
+token_store = "file"
+`
+	want := map[string]int{
+		"api_url":                      2,
+		"scopes":                       3,
+		"editor":                       7,
+		"quoted.key":                   10,
+		"sort":                         11,
+		"keys":                         13,
+		"keys.down":                    14,
+		"keys.up":                      15,
+		"profiles":                     17,
+		"profiles.work":                17,
+		"profiles.work.colors":         18,
+		"profiles.work.colors.default": 18,
+		"profiles.work.colors.default.background": 18,
+		"profiles.my-home":                        20,
+		"profiles.my-home.token_store":            21,
+	}
+	if got := keyLines(data); !reflect.DeepEqual(got, want) {
+		t.Errorf("keyLines() = %v, want %v", got, want)
+	}
+}
+
+func TestLineOf(t *testing.T) {
+	lines := map[string]int{"keys": 3, "keys.down": 4}
+	tests := []struct {
+		key  []string
+		want int
+	}{
+		{[]string{"keys", "down"}, 4},
+		// Set inline, so only the table is known
+		{[]string{"keys", "up"}, 3},
+		{[]string{"sort"}, 0},
+		{nil, 0},
+	}
+	for _, test := range tests {
+		if got := lineOf(lines, test.key...); got != test.want {
+			t.Errorf("lineOf(%q) = %d, want %d", test.key, got, test.want)
+		}
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			"unknown setting",
+			"sort = \"title\"\n\n[profiles.work]\nbogus = 1\n",
+			":4: unknown setting 'profiles.work.bogus'",
+		},
+		{
+			"invalid value",
+			"api_url = \"https://notes.example.com/\"\ntoken_store = \"bogus\"\n",
+			":2: invalid token store 'bogus'",
+		},
+		{
+			"invalid value in profile",
+			"[profiles.work]\n\nlogin_flow = \"bogus\"\n",
+			":3: profile 'work': invalid login flow 'bogus'",
+		},
+		{
+			"invalid key",
+			"[keys]\ndown = [\n  \"j\",\n  \"ctrl+1\",\n]\n",
+			":2: invalid key 'ctrl+1'",
+		},
+		{
+			"invalid color",
+			"[colors]\ndefault = { background = \"puce\" }\n",
+			":2: invalid color 'puce'",
+		},
+		{
+			"wrong type",
+			"\nwrap_selection = \"yes\"\n",
+			":2: incompatible types",
+		},
+		{
+			"syntax error",
+			"sort = \"title\"\nsort \"title\"\n",
+			":2: expected",
+		},
+		{
+			"unknown default profile",
+			"\nprofile = \"work\"\n",
+			":2: unknown profile 'work'",
+		},
+		{
+			"invalid profile name",
+			"[profiles.\"a b\"]\n",
+			":1: invalid profile name 'a b'",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.toml")
+			if err := os.WriteFile(path, []byte(test.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadFile(path)
+			if err == nil || !strings.HasPrefix(err.Error(), path+test.want) {
+				t.Errorf("LoadFile() returned error %v, want one starting %q", err, path+test.want)
+			}
+		})
+	}
+}
+
+func TestFileErrorf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	content := "[keys]\ndown = \"j\"\n\n[profiles.work]\n[profiles.work.keys]\nup = \"k\"\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() returned error: %v", err)
+	}
+	tests := []struct {
+		profile string
+		key     []string
+		want    string
+	}{
+		{"", []string{"keys", "down"}, path + ":2: oops"},
+		{"default", []string{"keys", "down"}, path + ":2: oops"},
+		{"work", []string{"keys", "up"}, path + ":6: profile 'work': oops"},
+		// Inherited from the top level
+		{"work", []string{"keys", "down"}, path + ":2: profile 'work': oops"},
+		{"", []string{"sort"}, path + ": oops"},
+	}
+	for _, test := range tests {
+		if got := file.Errorf(test.profile, test.key, "oops").Error(); got != test.want {
+			t.Errorf("Errorf(%q, %q) = %q, want %q", test.profile, test.key, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// keyLines finds the line every key in a TOML document is set on, by its
+// dotted path, e.g. "profiles.work.keys.down". Tables are included, at the
+// line of their header. Keys inside inline tables & arrays aren't, so look
+// them up with lineOf. The document must already have been decoded, since
+// values are only skipped over, not checked.
+func keyLines(data string) map[string]int {
+	lines := map[string]int{}
+	s := &lineScanner{data: data, line: 1}
+	table := []string{}
+	for {
+		s.skipSpace(true)
+		if s.done() {
+			return lines
+		}
+		switch s.peek() {
+		case '#':
+			s.skipComment()
+		case '[':
+			s.next()
+			if s.peek() == '[' {
+				// An array of tables; its elements all share a path
+				s.next()
+			}
+			table = s.key()
+			setLine(lines, table, s.line)
+			s.skipLine()
+		default:
+			key := append(append([]string{}, table...), s.key()...)
+			setLine(lines, key, s.line)
+			s.skipSpace(false)
+			if s.peek() == '=' {
+				s.next()
+			}
+			s.skipValue()
+		}
+	}
+}
+
+// setLine records line for key & for any of the tables it implicitly
+// creates, e.g. "a" & "a.b" for "a.b.c = 1".
+func setLine(lines map[string]int, key []string, line int) {
+	for i := 1; i <= len(key); i++ {
+		path := strings.Join(key[:i], ".")
+		if _, ok := lines[path]; !ok || i == len(key) {
+			lines[path] = line
+		}
+	}
+}
+
+// lineOf returns the line key is set on, or the line of the closest table
+// containing it if it's set inline, or 0 if it's not in lines at all.
+func lineOf(lines map[string]int, key ...string) int {
+	for i := len(key); i > 0; i-- {
+		if line, ok := lines[strings.Join(key[:i], ".")]; ok {
+			return line
+		}
+	}
+	return 0
+}
+
+type lineScanner struct {
+	data string
+	pos  int
+	line int
+}
+
+func (s *lineScanner) done() bool {
+	return s.pos >= len(s.data)
+}
+
+func (s *lineScanner) peek() byte {
+	if s.done() {
+		return 0
+	}
+	return s.data[s.pos]
+}
+
+func (s *lineScanner) next() byte {
+	c := s.peek()
+	s.pos++
+	if c == '\n' {
+		s.line++
+	}
+	return c
+}
+
+func (s *lineScanner) skipSpace(newlines bool) {
+	for c := s.peek(); c == ' ' || c == '\t' || c == '\r' || (newlines && c == '\n'); c = s.peek() {
+		s.next()
+	}
+}
+
+func (s *lineScanner) skipComment() {
+	for !s.done() && s.peek() != '\n' {
+		s.next()
+	}
+}
+
+// skipLine skips the rest of the line, including the newline.
+func (s *lineScanner) skipLine() {
+	s.skipComment()
+	s.next()
+}
+
+// key reads a key made of bare & quoted parts separated by dots, stopping
+// at whatever follows it ('=' or ']').
+func (s *lineScanner) key() []string {
+	parts := []string{}
+	for {
+		s.skipSpace(false)
+		var part strings.Builder
+		switch c := s.peek(); c {
+		case '"', '\'':
+			s.next()
+			for !s.done() && s.peek() != c && s.peek() != '\n' {
+				if c == '"' && s.peek() == '\\' {
+					part.WriteByte(s.next())
+				}
+				part.WriteByte(s.next())
+			}
+			s.next()
+		default:
+			for c := s.peek(); isBareKeyChar(c); c = s.peek() {
+				part.WriteByte(s.next())
+			}
+		}
+		parts = append(parts, unescapeKey(part.String()))
+		s.skipSpace(false)
+		if s.peek() != '.' {
+			return parts
+		}
+		s.next()
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '-'
+}
+
+// unescapeKey undoes escapes in a quoted key; only keys with escapes in them
+// need it.
+func unescapeKey(key string) string {
+	if !strings.Contains(key, `\`) {
+		return key
+	}
+	var unquoted string
+	if _, err := toml.Decode(fmt.Sprintf("k = \"%s\"", key), &struct {
+		K *string `toml:"k"`
+	}{&unquoted}); err != nil {
+		return key
+	}
+	return unquoted
+}
+
+// skipValue skips a value & the rest of its line, including arrays & strings
+// that span several lines.
+func (s *lineScanner) skipValue() {
+	depth := 0
+	for !s.done() {
+		switch c := s.peek(); c {
+		case '"', '\'':
+			s.skipString()
+		case '[', '{':
+			depth++
+			s.next()
+		case ']', '}':
+			depth--
+			s.next()
+		case '#':
+			s.skipComment()
+		case '\n':
+			s.next()
+			if depth <= 0 {
+				return
+			}
+		default:
+			s.next()
+		}
+	}
+}
+
+func (s *lineScanner) skipString() {
+	quote := s.data[s.pos : s.pos+1]
+	if strings.HasPrefix(s.data[s.pos:], quote+quote+quote) {
+		quote = quote + quote + quote
+	}
+	for range quote {
+		s.next()
+	}
+	for !s.done() {
+		if quote[0] == '"' && s.peek() == '\\' {
+			s.next()
+			s.next()
+			continue
+		}
+		if strings.HasPrefix(s.data[s.pos:], quote) {
+			for range quote {
+				s.next()
+			}
+			// A multi-line string may end with up to two more quotes
+			for len(quote) == 3 && s.peek() == quote[0] {
+				s.next()
+			}
+			return
+		}
+		if len(quote) == 1 && s.peek() == '\n' {
+			return
+		}
+		s.next()
+	}
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"mrshanahan.com/notes-term/internal/keyspec"
+)
+
+const (
+	// Order of the note list; see Config.Sort
+	SORT_SERVER  = "server"
+	SORT_TITLE   = "title"
+	SORT_CREATED = "created"
+	SORT_UPDATED = "updated"
+)
+
+var (
+	SortOrders = []string{SORT_SERVER, SORT_TITLE, SORT_CREATED, SORT_UPDATED}
+)
+
+// Key is a key spec as accepted by keyspec.Parse, e.g. "j", "ctrl+n" or
+// "g g".
+type Key string
+
+func (k *Key) UnmarshalText(text []byte) error {
+	if _, err := keyspec.Parse(string(text)); err != nil {
+		return err
+	}
+	*k = Key(text)
+	return nil
+}
+
+// KeyList is the keys bound to a command. In the config file it can be a
+// single key or a list; an empty list unbinds the command.
+type KeyList []Key
+
+func (l *KeyList) UnmarshalTOML(data any) error {
+	values, ok := data.([]any)
+	if !ok {
+		values = []any{data}
+	}
+	keys := KeyList{}
+	for _, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("keys must be strings, not %T", v)
+		}
+		var key Key
+		if err := key.UnmarshalText([]byte(s)); err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	*l = keys
+	return nil
+}
+
+// colorNames are the names accepted for a Color, mapped to their offset from
+// the base SGR code (30 for foreground, 40 for background).
+var colorNames = map[string]int{
+	"black":   0,
+	"red":     1,
+	"green":   2,
+	"yellow":  3,
+	"blue":    4,
+	"magenta": 5,
+	"cyan":    6,
+	"white":   7,
+	"default": 9,
+}
+
+// Color is a color name, e.g. "cyan" or "bright-black".
+type Color string
+
+func (c *Color) UnmarshalText(text []byte) error {
+	if _, err := parseColor(string(text)); err != nil {
+		return err
+	}
+	*c = Color(text)
+	return nil
+}
+
+// Code returns the offset of the color from the base SGR code, e.g. 6 for
+// "cyan" or 66 for "bright-cyan".
+func (c Color) Code() int {
+	code, _ := parseColor(string(c))
+	return code
+}
+
+func parseColor(name string) (int, error) {
+	lower := strings.ToLower(name)
+	bright := 0
+	if base, ok := strings.CutPrefix(lower, "bright-"); ok {
+		lower, bright = base, 60
+	}
+	offset, ok := colorNames[lower]
+	if !ok || (bright != 0 && lower == "default") {
+		return 0, fmt.Errorf("invalid color '%s'", name)
+	}
+	return offset + bright, nil
+}
+
+type ColorPair struct {
+	Background Color `toml:"background"`
+	Foreground Color `toml:"foreground"`
+}
+
+type Colors struct {
+	// Most of the UI
+	Default ColorPair `toml:"default"`
+	// The selected note & focused buttons
+	Highlight ColorPair `toml:"highlight"`
+	// Error boxes
+	Error ColorPair `toml:"error"`
+	// Code in the Markdown preview
+	Code ColorPair `toml:"code"`
+}
+
+func defaultColors() Colors {
+	return Colors{
+		Default:   ColorPair{"cyan", "white"},
+		Highlight: ColorPair{"white", "cyan"},
+		Error:     ColorPair{"red", "white"},
+		Code:      ColorPair{"black", "yellow"},
+	}
+}
+
+// SortOrder is one of SortOrders.
+type SortOrder string
+
+func (s *SortOrder) UnmarshalText(text []byte) error {
+	if !slices.Contains(SortOrders, string(text)) {
+		return fmt.Errorf("invalid sort order '%s': must be one of %s", text, strings.Join(SortOrders, ", "))
+	}
+	*s = SortOrder(text)
+	return nil
+}
@@ -0,0 +1,146 @@
+package content
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mrshanahan/notes-api/pkg/notes"
+)
+
+// Cache holds note contents so repeated searches & previews don't have to go
+// back to the API. Entries are keyed by note ID and are considered stale once
+// the note's UpdatedOn no longer matches.
+//
+// Entries are kept in memory &, if the cache has a folder, in files there so
+// that they last between runs; only Get reads the files. Files are named after
+// the note's ID & the UpdatedOn they're good for, so stale ones are never
+// read. Failing to read or write them only costs a fetch, so it isn't
+// reported.
+type Cache struct {
+	mu      sync.Mutex
+	dir     string
+	entries map[int64]*cacheEntry
+	fetch   func(id int64) ([]byte, error)
+}
+
+type cacheEntry struct {
+	updatedOn time.Time
+	content   []byte
+}
+
+// NewCache returns a cache that fetches missing content with fetch & keeps it
+// in dir, or only in memory if dir is "".
+func NewCache(dir string, fetch func(id int64) ([]byte, error)) *Cache {
+	return &Cache{
+		dir:     dir,
+		entries: map[int64]*cacheEntry{},
+		fetch:   fetch,
+	}
+}
+
+// Get returns the content of the given note, reading it from the cache folder
+// or fetching it if it's not in memory or the cached copy is out of date.
+func (c *Cache) Get(note *notes.Note) ([]byte, error) {
+	if content, ok := c.Lookup(note); ok {
+		return content, nil
+	}
+	if content, ok := c.readFile(note); ok {
+		return content, nil
+	}
+
+	content, err := c.fetch(note.ID)
+	if err != nil {
+		return nil, err
+	}
+	c.Put(note, content)
+	return content, nil
+}
+
+// Lookup returns the content of the given note if it's in memory, without
+// reading the cache folder or fetching, so it never blocks.
+func (c *Cache) Lookup(note *notes.Note) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[note.ID]
+	if ok && entry.updatedOn.Equal(note.UpdatedOn) {
+		return entry.content, true
+	}
+	return nil, false
+}
+
+// readFile reads the content of the given note from the cache folder into
+// memory.
+func (c *Cache) readFile(note *notes.Note) ([]byte, bool) {
+	if c.dir == "" {
+		return nil, false
+	}
+	content, err := os.ReadFile(c.path(note.ID, note.UpdatedOn))
+	if err != nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[note.ID] = &cacheEntry{note.UpdatedOn, content}
+	return content, true
+}
+
+// Put stores content for the given note, e.g. after uploading new content.
+func (c *Cache) Put(note *notes.Note, content []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[note.ID] = &cacheEntry{note.UpdatedOn, content}
+	if c.dir == "" {
+		return
+	}
+	c.removeFiles(note.ID)
+	c.writeFile(c.path(note.ID, note.UpdatedOn), content)
+}
+
+func (c *Cache) Invalidate(id int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, id)
+	if c.dir != "" {
+		c.removeFiles(id)
+	}
+}
+
+func (c *Cache) path(id int64, updatedOn time.Time) string {
+	return filepath.Join(c.dir, fmt.Sprintf("%d-%d", id, updatedOn.UnixNano()))
+}
+
+// removeFiles removes every file cached for the note with the given ID.
+// Caller must hold c.mu.
+func (c *Cache) removeFiles(id int64) {
+	files, _ := filepath.Glob(filepath.Join(c.dir, fmt.Sprintf("%d-*", id)))
+	for _, f := range files {
+		os.Remove(f)
+	}
+}
+
+// writeFile writes content to path through a temporary file, so that the
+// file is either whole or not there at all. Caller must hold c.mu.
+func (c *Cache) writeFile(path string, content []byte) {
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+}
@@ -0,0 +1,98 @@
+package content
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mrshanahan/notes-api/pkg/notes"
+)
+
+// countingFetch returns content for every note, counting how often it's
+// asked.
+func countingFetch(content string) (func(id int64) ([]byte, error), *int) {
+	fetches := 0
+	return func(id int64) ([]byte, error) {
+		fetches++
+		return []byte(content), nil
+	}, &fetches
+}
+
+func TestCacheLastsBetweenRuns(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "content")
+	note := &notes.Note{ID: 7, UpdatedOn: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+
+	fetch, fetches := countingFetch("v1")
+	if content, err := NewCache(dir, fetch).Get(note); err != nil || string(content) != "v1" {
+		t.Fatalf("Get() = %q, %v; want %q", content, err, "v1")
+	}
+
+	// A new run finds it on disk, though only Get looks there
+	failing := func(id int64) ([]byte, error) { return nil, errors.New("offline") }
+	cache := NewCache(dir, failing)
+	if _, ok := cache.Lookup(note); ok {
+		t.Error("Lookup() in a new cache read the cache folder")
+	}
+	if content, err := cache.Get(note); err != nil || string(content) != "v1" {
+		t.Errorf("Get() in a new cache = %q, %v; want %q", content, err, "v1")
+	}
+	if content, ok := cache.Lookup(note); !ok || string(content) != "v1" {
+		t.Errorf("Lookup() after Get() = %q, %v; want %q", content, ok, "v1")
+	}
+	if *fetches != 1 {
+		t.Errorf("fetched %d times, want 1", *fetches)
+	}
+
+	// Once the note changes the cached copy is stale & replaced
+	updated := &notes.Note{ID: 7, UpdatedOn: note.UpdatedOn.Add(time.Minute)}
+	if _, err := NewCache(dir, failing).Get(updated); err == nil {
+		t.Error("Get() found content for an updated note")
+	}
+	cache.Put(updated, []byte("v2"))
+	if content, err := NewCache(dir, failing).Get(updated); err != nil || string(content) != "v2" {
+		t.Errorf("Get() after Put() = %q, %v; want %q", content, err, "v2")
+	}
+	files, _ := os.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("cache folder has %d files, want 1", len(files))
+	}
+
+	cache.Invalidate(7)
+	if _, err := NewCache(dir, failing).Get(updated); err == nil {
+		t.Error("Get() found content after Invalidate()")
+	}
+}
+
+func TestCacheKeepsNotesApart(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewCache(dir, nil)
+	one, twelve := &notes.Note{ID: 1}, &notes.Note{ID: 12}
+	cache.Put(one, []byte("one"))
+	cache.Put(twelve, []byte("twelve"))
+	cache.Invalidate(1)
+
+	failing := func(id int64) ([]byte, error) { return nil, errors.New("offline") }
+	cache = NewCache(dir, failing)
+	if _, err := cache.Get(one); err == nil {
+		t.Error("Get() found note 1 after invalidating it")
+	}
+	if content, err := cache.Get(twelve); err != nil || string(content) != "twelve" {
+		t.Errorf("Get() for note 12 = %q, %v; want %q", content, err, "twelve")
+	}
+}
+
+func TestCacheInMemory(t *testing.T) {
+	fetch, fetches := countingFetch("content")
+	cache := NewCache("", fetch)
+	note := &notes.Note{ID: 1}
+	for i := 0; i < 2; i++ {
+		if content, err := cache.Get(note); err != nil || string(content) != "content" {
+			t.Fatalf("Get() = %q, %v; want %q", content, err, "content")
+		}
+	}
+	if *fetches != 1 {
+		t.Errorf("fetched %d times, want 1", *fetches)
+	}
+}
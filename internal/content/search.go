@@ -0,0 +1,106 @@
+package content
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"sync"
+
+	"github.com/mrshanahan/notes-api/pkg/notes"
+)
+
+const (
+	DEFAULT_SEARCH_PARALLELISM = 8
+	MAX_SEARCH_RESULTS         = 1000
+)
+
+// Match is a single line of a note containing the search query.
+type Match struct {
+	Note  *notes.Note
+	Line  int    // 1-based line number
+	Text  string // Full text of the line
+	Start int    // Byte offset of the match within Text
+	End   int    // Byte offset just past the match within Text
+}
+
+// SearchResult holds every match found, up to MAX_SEARCH_RESULTS, along with
+// any notes that could not be searched.
+type SearchResult struct {
+	Matches []*Match
+	Errors  map[int64]error
+	// Whether matches past MAX_SEARCH_RESULTS were left out
+	Truncated bool
+}
+
+// Search looks for query (case-insensitively) in the contents of every note,
+// fetching through the cache with at most parallelism requests in flight.
+// Matches are ordered by note, then by line. Every note is searched even once
+// there are too many matches, so Errors is complete.
+func Search(cache *Cache, ns []*notes.Note, query string, parallelism int) *SearchResult {
+	if parallelism <= 0 {
+		parallelism = DEFAULT_SEARCH_PARALLELISM
+	}
+
+	perNote := make([][]*Match, len(ns))
+	errs := make([]error, len(ns))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, n := range ns {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, n *notes.Note) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			content, err := cache.Get(n)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			perNote[i] = searchContent(n, content, query)
+		}(i, n)
+	}
+	wg.Wait()
+
+	result := &SearchResult{Matches: []*Match{}, Errors: map[int64]error{}}
+	for i, ms := range perNote {
+		if errs[i] != nil {
+			result.Errors[ns[i].ID] = errs[i]
+		}
+		if room := MAX_SEARCH_RESULTS - len(result.Matches); len(ms) > room {
+			ms, result.Truncated = ms[:room], true
+		}
+		result.Matches = append(result.Matches, ms...)
+	}
+	return result
+}
+
+func searchContent(note *notes.Note, content []byte, query string) []*Match {
+	matches := []*Match{}
+	lowerQuery := strings.ToLower(query)
+	if lowerQuery == "" {
+		return matches
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum += 1
+		line := scanner.Text()
+		lowerLine := strings.ToLower(line)
+		idx := strings.Index(lowerLine, lowerQuery)
+		if idx < 0 {
+			continue
+		}
+
+		start, end := idx, idx+len(lowerQuery)
+		if len(lowerLine) != len(line) {
+			// Lowercasing changed byte widths, so offsets don't line up
+			// with the original text; match without highlighting.
+			start, end = 0, 0
+		}
+		matches = append(matches, &Match{note, lineNum, line, start, end})
+	}
+	return matches
+}
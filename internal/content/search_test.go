@@ -0,0 +1,86 @@
+package content
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mrshanahan/notes-api/pkg/notes"
+)
+
+// fakeNotes returns notes with IDs from 1 & a fetch for them serving
+// contents by ID; IDs missing from contents fail to fetch.
+func fakeNotes(n int, contents map[int64]string) ([]*notes.Note, func(id int64) ([]byte, error)) {
+	ns := []*notes.Note{}
+	for i := 1; i <= n; i++ {
+		ns = append(ns, &notes.Note{ID: int64(i), Title: fmt.Sprintf("note %d", i)})
+	}
+	return ns, func(id int64) ([]byte, error) {
+		content, ok := contents[id]
+		if !ok {
+			return nil, errors.New("offline")
+		}
+		return []byte(content), nil
+	}
+}
+
+func TestSearch(t *testing.T) {
+	ns, fetch := fakeNotes(3, map[int64]string{
+		1: "Shopping\nmilk\nOat MILK",
+		2: "nothing here",
+	})
+	result := Search(NewCache("", fetch), ns, "milk", 2)
+
+	type match struct {
+		id         int64
+		line       int
+		start, end int
+	}
+	want := []match{{1, 2, 0, 4}, {1, 3, 4, 8}}
+	got := []match{}
+	for _, m := range result.Matches {
+		got = append(got, match{m.Note.ID, m.Line, m.Start, m.End})
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Search() matches = %v, want %v", got, want)
+	}
+	if _, ok := result.Errors[3]; len(result.Errors) != 1 || !ok {
+		t.Errorf("Search() errors = %v, want one for note 3", result.Errors)
+	}
+	if result.Truncated {
+		t.Error("Search() says results were left out")
+	}
+}
+
+func TestSearchLimit(t *testing.T) {
+	many := strings.Repeat("match\n", MAX_SEARCH_RESULTS-1)
+	ns, fetch := fakeNotes(4, map[int64]string{
+		1: many,
+		2: "match\nmatch\nmatch",
+		3: "match",
+	})
+	result := Search(NewCache("", fetch), ns, "match", 0)
+
+	if len(result.Matches) != MAX_SEARCH_RESULTS {
+		t.Errorf("Search() returned %d matches, want %d", len(result.Matches), MAX_SEARCH_RESULTS)
+	}
+	if !result.Truncated {
+		t.Error("Search() didn't say results were left out")
+	}
+	if last := result.Matches[len(result.Matches)-1]; last.Note.ID != 2 || last.Line != 1 {
+		t.Errorf("last match is note %d line %d, want note 2 line 1", last.Note.ID, last.Line)
+	}
+	// Notes past the limit are still searched
+	if _, ok := result.Errors[4]; !ok {
+		t.Errorf("Search() errors = %v, want one for note 4", result.Errors)
+	}
+}
+
+func TestSearchExactlyAtLimit(t *testing.T) {
+	ns, fetch := fakeNotes(1, map[int64]string{1: strings.Repeat("match\n", MAX_SEARCH_RESULTS)})
+	result := Search(NewCache("", fetch), ns, "match", 0)
+	if len(result.Matches) != MAX_SEARCH_RESULTS || result.Truncated {
+		t.Errorf("Search() = %d matches, truncated %v; want %d, not truncated", len(result.Matches), result.Truncated, MAX_SEARCH_RESULTS)
+	}
+}
@@ -0,0 +1,221 @@
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	PATH_PLACEHOLDER = "{path}"
+	LINE_PLACEHOLDER = "{line}"
+)
+
+var (
+	// Editors tried in order when nothing is configured.
+	FallbackEditors = []string{"nvim", "vim", "vi", "nano"}
+
+	ErrNoEditor = errors.New("no editor found; set $VISUAL or $EDITOR, or configure an editor command")
+)
+
+// Editor is a command template used to open files, e.g. "code --wait {path}"
+// or "nvim +{line} {path}".
+type Editor struct {
+	Args []string
+	// Extra arguments passed when opening a file read-only, e.g. "-R" for vim
+	ReadOnlyArgs []string
+}
+
+// Resolve picks the editor to use: the configured command if given, then
+// $VISUAL, then $EDITOR, then the first of FallbackEditors found on $PATH.
+// readOnlyFlags overrides the arguments used to open files read-only; if
+// empty, the defaults for known editors are used.
+func Resolve(configured string, readOnlyFlags string) (*Editor, error) {
+	var ed *Editor
+	for _, candidate := range []string{configured, os.Getenv("VISUAL"), os.Getenv("EDITOR")} {
+		if strings.TrimSpace(candidate) == "" {
+			continue
+		}
+		parsed, err := Parse(candidate)
+		if err != nil {
+			return nil, err
+		}
+		ed = parsed
+		break
+	}
+
+	if ed == nil {
+		for _, name := range FallbackEditors {
+			if _, err := exec.LookPath(name); err == nil {
+				ed = &Editor{Args: []string{name}}
+				break
+			}
+		}
+	}
+	if ed == nil {
+		return nil, ErrNoEditor
+	}
+
+	if strings.TrimSpace(readOnlyFlags) != "" {
+		args, err := splitArgs(readOnlyFlags)
+		if err != nil {
+			return nil, fmt.Errorf("invalid read-only editor flags %q: %w", readOnlyFlags, err)
+		}
+		ed.ReadOnlyArgs = args
+	} else {
+		ed.ReadOnlyArgs = defaultReadOnlyArgs(ed.Name())
+	}
+	return ed, nil
+}
+
+// Parse splits an editor command into arguments. Arguments may be quoted with
+// single or double quotes; backslash escapes the next character outside of
+// single quotes.
+func Parse(command string) (*Editor, error) {
+	args, err := splitArgs(command)
+	if err != nil {
+		return nil, fmt.Errorf("invalid editor command %q: %w", command, err)
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("invalid editor command %q: empty command", command)
+	}
+	return &Editor{Args: args}, nil
+}
+
+// Name returns the base name of the editor executable, e.g. "nvim".
+func (e *Editor) Name() string {
+	return filepath.Base(e.Args[0])
+}
+
+// Command builds the command to open path, positioned at line if line is
+// positive. Placeholders are substituted if present; otherwise the path is
+// appended and, for editors we know about, a line argument is added. If
+// readOnly is set, ReadOnlyArgs are passed right after the executable.
+func (e *Editor) Command(path string, line int, readOnly bool) *exec.Cmd {
+	hasPath, hasLine := false, false
+	for _, a := range e.Args[1:] {
+		hasPath = hasPath || strings.Contains(a, PATH_PLACEHOLDER)
+		hasLine = hasLine || strings.Contains(a, LINE_PLACEHOLDER)
+	}
+
+	lineStr := "1"
+	if line > 0 {
+		lineStr = strconv.Itoa(line)
+	}
+
+	args := []string{}
+	if readOnly {
+		args = append(args, e.ReadOnlyArgs...)
+	}
+	for _, a := range e.Args[1:] {
+		a = strings.ReplaceAll(a, PATH_PLACEHOLDER, path)
+		a = strings.ReplaceAll(a, LINE_PLACEHOLDER, lineStr)
+		args = append(args, a)
+	}
+	if !hasPath {
+		if line > 0 && !hasLine {
+			args = append(args, lineArgs(e.Name(), path, line)...)
+		} else {
+			args = append(args, path)
+		}
+	}
+
+	cmd := exec.Command(e.Args[0], args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd
+}
+
+// Run opens path in the editor & waits for it to exit.
+func (e *Editor) Run(path string, line int, readOnly bool) error {
+	cmd := e.Command(path, line, readOnly)
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return fmt.Errorf("editor '%s' exited with status %d", e.Name(), exitErr.ExitCode())
+	} else if errors.Is(err, exec.ErrNotFound) {
+		return fmt.Errorf("editor '%s' not found", e.Args[0])
+	} else if err != nil {
+		return fmt.Errorf("could not start editor '%s': %w", e.Name(), err)
+	}
+	return nil
+}
+
+// lineArgs returns the arguments for opening path at line for editors whose
+// convention we know; otherwise the line is ignored.
+func lineArgs(name string, path string, line int) []string {
+	switch name {
+	case "vi", "vim", "nvim", "nano", "emacs", "emacsclient", "kak", "micro", "mg":
+		return []string{fmt.Sprintf("+%d", line), path}
+	case "hx", "helix":
+		return []string{fmt.Sprintf("%s:%d", path, line)}
+	case "code", "codium", "subl":
+		return []string{"--goto", fmt.Sprintf("%s:%d", path, line)}
+	default:
+		return []string{path}
+	}
+}
+
+// defaultReadOnlyArgs returns the flags that make known editors refuse to
+// modify the file. Editors without such a flag (emacs, helix, ...) still get a
+// file without write permissions, which most of them honor.
+func defaultReadOnlyArgs(name string) []string {
+	switch name {
+	case "vi", "vim", "nvim", "view":
+		return []string{"-R"}
+	case "nano":
+		return []string{"-v"}
+	case "kak":
+		return []string{"-ro"}
+	case "micro":
+		return []string{"-readonly", "true"}
+	default:
+		return []string{}
+	}
+}
+
+func splitArgs(s string) ([]string, error) {
+	args := []string{}
+	var cur strings.Builder
+	inArg, escaped := false, false
+	var quote rune = 0
+	for _, r := range s {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if escaped {
+		return nil, errors.New("trailing backslash")
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,93 @@
+package editor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+		err   bool
+	}{
+		{"", []string{}, false},
+		{"   ", []string{}, false},
+		{"vim", []string{"vim"}, false},
+		{"  code  --wait\t{path} ", []string{"code", "--wait", "{path}"}, false},
+		{`"my editor" -f`, []string{"my editor", "-f"}, false},
+		{`'my editor' -f`, []string{"my editor", "-f"}, false},
+		{`pre"quoted part"post`, []string{"prequoted partpost"}, false},
+		{`""`, []string{""}, false},
+		{`a '' b`, []string{"a", "", "b"}, false},
+		{`my\ editor`, []string{"my editor"}, false},
+		{`"say \"hi\""`, []string{`say "hi"`}, false},
+		// Backslash is literal inside single quotes
+		{`'C:\bin\ed'`, []string{`C:\bin\ed`}, false},
+		{`"it's"`, []string{"it's"}, false},
+		{`'say "hi"'`, []string{`say "hi"`}, false},
+		{`\\`, []string{`\`}, false},
+		{`vim\`, nil, true},
+		{`"unterminated`, nil, true},
+		{`'unterminated`, nil, true},
+	}
+	for _, test := range tests {
+		got, err := splitArgs(test.input)
+		if test.err {
+			if err == nil {
+				t.Errorf("splitArgs(%q) = %q, want an error", test.input, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("splitArgs(%q) returned error: %v", test.input, err)
+		} else if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitArgs(%q) = %q, want %q", test.input, got, test.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, command := range []string{"", "  ", `"unterminated`} {
+		if _, err := Parse(command); err == nil {
+			t.Errorf("Parse(%q) returned no error", command)
+		}
+	}
+}
+
+func TestCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		line     int
+		readOnly bool
+		want     []string
+	}{
+		{"path placeholder", "code --wait {path}", 0, false, []string{"code", "--wait", "/tmp/n.md"}},
+		{"both placeholders", "nvim +{line} {path}", 12, false, []string{"nvim", "+12", "/tmp/n.md"}},
+		{"placeholders inside an argument", "hx {path}:{line}", 3, false, []string{"hx", "/tmp/n.md:3"}},
+		{"line defaults to 1", "nvim +{line} {path}", 0, false, []string{"nvim", "+1", "/tmp/n.md"}},
+		{"path appended when missing", "myeditor --flag", 5, false, []string{"myeditor", "--flag", "/tmp/n.md"}},
+		{"path appended after line placeholder", "myeditor -l {line}", 5, false, []string{"myeditor", "-l", "5", "/tmp/n.md"}},
+		{"known editor line argument", "vim", 7, false, []string{"vim", "+7", "/tmp/n.md"}},
+		{"known editor without line", "vim", 0, false, []string{"vim", "/tmp/n.md"}},
+		{"helix line argument", "/usr/bin/hx", 7, false, []string{"/usr/bin/hx", "/tmp/n.md:7"}},
+		{"vscode line argument", "code --wait", 7, false, []string{"code", "--wait", "--goto", "/tmp/n.md:7"}},
+		{"unknown editor ignores line", "ed", 7, false, []string{"ed", "/tmp/n.md"}},
+		{"read-only flags first", "vim +{line} {path}", 2, true, []string{"vim", "-R", "+2", "/tmp/n.md"}},
+		{"placeholder in executable is left alone", "{path} {path}", 0, false, []string{"{path}", "/tmp/n.md"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ed, err := Parse(test.command)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", test.command, err)
+			}
+			ed.ReadOnlyArgs = defaultReadOnlyArgs(ed.Name())
+			got := ed.Command("/tmp/n.md", test.line, test.readOnly).Args
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Command(%q, %d, %v) = %q, want %q", test.command, test.line, test.readOnly, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package fuzzy
+
+import (
+	"sort"
+	"unicode"
+
+	"mrshanahan.com/notes-term/internal/util"
+)
+
+const (
+	scoreMatch       = 16
+	bonusBoundary    = 8
+	bonusConsecutive = 6
+	bonusFirstChar   = 4
+	penaltyGap       = 1
+)
+
+// Match describes how a pattern matched a piece of text.
+type Match struct {
+	Index     int   // Index of the matched item in the original list
+	Score     int   // Higher is better
+	Positions []int // Byte offsets of the matched runes in the text
+}
+
+// MatchString fuzzily matches pattern against text, case-insensitively. The
+// runes in pattern must all appear in text in order, but not necessarily
+// consecutively. Returns false if there is no match.
+func MatchString(pattern, text string) (int, []int, bool) {
+	pat := []rune(toLower(pattern))
+	if len(pat) == 0 {
+		return 0, []int{}, true
+	}
+
+	runes, offsets := []rune{}, []int{}
+	for i, r := range text {
+		runes = append(runes, r)
+		offsets = append(offsets, i)
+	}
+	lower := []rune(toLower(string(runes)))
+	if len(pat) > len(runes) {
+		return 0, nil, false
+	}
+
+	// scores[i][j] is the best score for matching pat[:i+1] with pat[i]
+	// landing on runes[j]; prev[i][j] is where pat[i-1] landed for that score.
+	const none = -1 << 30
+	scores := make([][]int, len(pat))
+	prev := make([][]int, len(pat))
+	for i := range pat {
+		scores[i] = make([]int, len(runes))
+		prev[i] = make([]int, len(runes))
+		for j := range runes {
+			scores[i][j], prev[i][j] = none, -1
+		}
+	}
+
+	for i, pr := range pat {
+		// Best value of scores[i-1][k] + k for k < j-1, used for gapped matches
+		bestGapped, bestGappedIdx := none, -1
+		for j := range runes {
+			if i > 0 && j >= 2 && scores[i-1][j-2] != none && scores[i-1][j-2]+(j-2) > bestGapped {
+				bestGapped, bestGappedIdx = scores[i-1][j-2]+(j-2), j-2
+			}
+			if lower[j] != pr {
+				continue
+			}
+
+			charScore := scoreMatch + boundaryBonus(runes, j)
+			if i == 0 {
+				scores[i][j] = charScore - penaltyGap*util.Min(j, 3).Value
+				if j == 0 {
+					scores[i][j] += bonusFirstChar
+				}
+				continue
+			}
+
+			if j >= 1 && scores[i-1][j-1] != none {
+				scores[i][j], prev[i][j] = scores[i-1][j-1]+charScore+bonusConsecutive, j-1
+			}
+			if bestGapped != none {
+				// scores[i-1][k] - penaltyGap*(j-k-1)
+				gapped := bestGapped - (j - 1) + charScore
+				if gapped > scores[i][j] {
+					scores[i][j], prev[i][j] = gapped, bestGappedIdx
+				}
+			}
+		}
+	}
+
+	last := len(pat) - 1
+	best, bestIdx := none, -1
+	for j := range runes {
+		if scores[last][j] > best {
+			best, bestIdx = scores[last][j], j
+		}
+	}
+	if bestIdx < 0 {
+		return 0, nil, false
+	}
+
+	positions := make([]int, len(pat))
+	for i, j := last, bestIdx; i >= 0; i-- {
+		positions[i] = offsets[j]
+		j = prev[i][j]
+	}
+	return best, positions, true
+}
+
+// Filter matches pattern against every item, returning the matches ordered
+// best first. Items with equal scores keep their original relative order.
+func Filter(pattern string, items []string) []*Match {
+	matches := []*Match{}
+	for i, item := range items {
+		score, positions, ok := MatchString(pattern, item)
+		if ok {
+			matches = append(matches, &Match{i, score, positions})
+		}
+	}
+	sort.SliceStable(matches, func(a, b int) bool {
+		return matches[a].Score > matches[b].Score
+	})
+	return matches
+}
+
+func boundaryBonus(runes []rune, j int) int {
+	if j == 0 {
+		return bonusBoundary
+	}
+	cur, before := runes[j], runes[j-1]
+	if !unicode.IsLetter(before) && !unicode.IsDigit(before) {
+		return bonusBoundary
+	}
+	if unicode.IsLower(before) && unicode.IsUpper(cur) {
+		return bonusBoundary
+	}
+	return 0
+}
+
+func toLower(s string) string {
+	rs := []rune(s)
+	for i, r := range rs {
+		rs[i] = unicode.ToLower(r)
+	}
+	return string(rs)
+}
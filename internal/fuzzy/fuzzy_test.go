@@ -0,0 +1,66 @@
+package fuzzy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFilterRanking(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		items   []string
+		want    []string
+	}{
+		{"prefix first", "note", []string{"a denote", "my note", "notes"}, []string{"notes", "my note", "a denote"}},
+		{"word boundaries", "gl", []string{"angle", "grocery list"}, []string{"grocery list", "angle"}},
+		{"shorter gaps", "gl", []string{"grocery list", "go-list"}, []string{"go-list", "grocery list"}},
+		{"camel case boundary", "nt", []string{"blunt", "myNotes"}, []string{"myNotes", "blunt"}},
+		{"contiguous runs", "abc", []string{"axxbxxc", "xxabcxx"}, []string{"xxabcxx", "axxbxxc"}},
+		{"case-insensitive", "TODO", []string{"todo list"}, []string{"todo list"}},
+		{"out of order", "ba", []string{"ab"}, []string{}},
+		{"pattern longer than text", "abcd", []string{"abc"}, []string{}},
+		{"ties keep order", "x", []string{"x1", "x2", "x3"}, []string{"x1", "x2", "x3"}},
+		{"empty pattern keeps everything", "", []string{"b", "a"}, []string{"b", "a"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := []string{}
+			for _, m := range Filter(test.pattern, test.items) {
+				got = append(got, test.items[m.Index])
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Filter(%q, %q) = %q, want %q", test.pattern, test.items, got, test.want)
+			}
+		})
+	}
+}
+
+func TestMatchStringPositions(t *testing.T) {
+	tests := []struct {
+		pattern string
+		text    string
+		want    []int
+	}{
+		{"abc", "abc", []int{0, 1, 2}},
+		{"gl", "grocery list", []int{0, 8}},
+		// Prefers the contiguous run over the first 'a'
+		{"ab", "xa xab", []int{4, 5}},
+		// ...but not over a match on the first character
+		{"ab", "a xab", []int{0, 4}},
+		// Positions are byte offsets, so runes after multi-byte ones shift
+		{"ca", "über café", []int{6, 7}},
+		{"é", "Café", []int{3}},
+		{"日記", "私の日記", []int{6, 9}},
+		{"É", "école", []int{0}},
+		{"", "anything", []int{}},
+	}
+	for _, test := range tests {
+		_, got, ok := MatchString(test.pattern, test.text)
+		if !ok {
+			t.Errorf("MatchString(%q, %q) didn't match", test.pattern, test.text)
+		} else if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("MatchString(%q, %q) positions = %v, want %v", test.pattern, test.text, got, test.want)
+		}
+	}
+}
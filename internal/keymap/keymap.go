@@ -0,0 +1,149 @@
+// Package keymap binds keys & key sequences to named commands.
+package keymap
+
+import (
+	"fmt"
+
+	"mrshanahan.com/notes-term/internal/keyspec"
+	"mrshanahan.com/notes-term/internal/window"
+)
+
+// Sequence is the keys that make up a binding, in the order they're pressed.
+type Sequence []window.Key
+
+// Parse parses a key spec; see keyspec.Parse.
+func Parse(spec string) (Sequence, error) {
+	keys, err := keyspec.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	seq := Sequence{}
+	for _, k := range keys {
+		seq = append(seq, window.SpecKey(k))
+	}
+	return seq, nil
+}
+
+// Label returns how to show a key spec in help, e.g. "CTRL+N" or "g g".
+func Label(spec string) string {
+	return keyspec.Label(spec)
+}
+
+// Mouse returns true if a valid key spec is made up of mouse keys only, e.g.
+// "wheeldown".
+func Mouse(spec string) bool {
+	keys, err := keyspec.Parse(spec)
+	if err != nil {
+		return false
+	}
+	for _, key := range keys {
+		if !key.Mouse() {
+			return false
+		}
+	}
+	return true
+}
+
+// ConflictError is returned by Bind for a key that conflicts with one bound
+// already.
+type ConflictError struct {
+	Spec    string
+	Command string
+	// The binding it conflicts with
+	OtherSpec    string
+	OtherCommand string
+}
+
+func (e *ConflictError) Error() string {
+	if e.Command == e.OtherCommand {
+		return fmt.Sprintf("key '%s' conflicts with '%s' for '%s'", e.Spec, e.OtherSpec, e.Command)
+	}
+	return fmt.Sprintf("key '%s' for '%s' conflicts with '%s' for '%s'", e.Spec, e.Command, e.OtherSpec, e.OtherCommand)
+}
+
+type binding struct {
+	spec    string
+	seq     Sequence
+	command string
+}
+
+// Keymap turns keys into commands, waiting for the rest of a sequence when a
+// key starts one.
+type Keymap struct {
+	bindings []*binding
+	pending  Sequence
+}
+
+func New() *Keymap {
+	return &Keymap{}
+}
+
+// Bind binds the key spec to command. A sequence can't be bound if it, or the
+// start of it, is bound already, since there'd be no telling which was meant.
+func (km *Keymap) Bind(spec string, command string) error {
+	seq, err := Parse(spec)
+	if err != nil {
+		return err
+	}
+	for _, b := range km.bindings {
+		if hasPrefix(b.seq, seq) || hasPrefix(seq, b.seq) {
+			return &ConflictError{spec, command, b.spec, b.command}
+		}
+	}
+	km.bindings = append(km.bindings, &binding{spec, seq, command})
+	return nil
+}
+
+// Feed takes the next key & returns the command it completes, if any. If the
+// key is part of an unfinished sequence, pending is true. Keys that don't
+// continue the pending sequence start a new one.
+func (km *Keymap) Feed(key window.Key) (command string, pending bool) {
+	started := len(km.pending) > 0
+	km.pending = append(km.pending, key)
+	if command, pending = km.match(); command != "" || pending || !started {
+		return command, pending
+	}
+	// Doesn't continue the sequence, but may start one of its own
+	km.pending = Sequence{key}
+	return km.match()
+}
+
+// Pending returns the keys of the unfinished sequence, if any.
+func (km *Keymap) Pending() Sequence {
+	return km.pending
+}
+
+// Reset drops any unfinished sequence.
+func (km *Keymap) Reset() {
+	km.pending = nil
+}
+
+func (km *Keymap) match() (string, bool) {
+	pending := false
+	for _, b := range km.bindings {
+		if !hasPrefix(b.seq, km.pending) {
+			continue
+		}
+		if len(b.seq) == len(km.pending) {
+			km.pending = nil
+			return b.command, false
+		}
+		pending = true
+	}
+	if !pending {
+		km.pending = nil
+	}
+	return "", pending
+}
+
+func hasPrefix(seq Sequence, prefix Sequence) bool {
+	if len(prefix) > len(seq) {
+		return false
+	}
+	for i := range prefix {
+		if seq[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,169 @@
+package keymap
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"mrshanahan.com/notes-term/internal/window"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Sequence
+		wantErr bool
+	}{
+		{"j", Sequence{window.Char('j')}, false},
+		{"ctrl+n", Sequence{window.Ctrl('n')}, false},
+		{"g g", Sequence{window.Char('g'), window.Char('g')}, false},
+		{" ", Sequence{window.Char(' ')}, false},
+		{"space", Sequence{window.Char(' ')}, false},
+		{"shift+tab", Sequence{{Code: window.KEY_TAB, Mod: window.MOD_SHIFT}}, false},
+		{"ctrl+i", Sequence{{Code: window.KEY_TAB}}, false},
+		{"alt+pgdn", Sequence{{Code: window.KEY_PGDN, Mod: window.MOD_ALT}}, false},
+		{"wheeldown", Sequence{{Code: window.KEY_WHEEL_DOWN}}, false},
+		{"", nil, true},
+		{"ctrl+1", nil, true},
+		{"g nope", nil, true},
+	}
+	for _, test := range tests {
+		got, err := Parse(test.spec)
+		if (err != nil) != test.wantErr || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Parse(%q) = %v, %v; want %v, error %v", test.spec, got, err, test.want, test.wantErr)
+		}
+	}
+}
+
+func TestMouse(t *testing.T) {
+	tests := []struct {
+		spec string
+		want bool
+	}{
+		{"wheelup", true},
+		{"wheelup wheeldown", true},
+		{"g wheeldown", false},
+		{"j", false},
+		{"nope", false},
+	}
+	for _, test := range tests {
+		if got := Mouse(test.spec); got != test.want {
+			t.Errorf("Mouse(%q) = %v, want %v", test.spec, got, test.want)
+		}
+	}
+}
+
+type bindTest struct {
+	spec    string
+	command string
+}
+
+func TestBindConflicts(t *testing.T) {
+	tests := []struct {
+		name  string
+		bound []bindTest
+		bind  bindTest
+		// nil for no conflict
+		conflict *ConflictError
+		wantErr  bool
+	}{
+		{"different keys", []bindTest{{"j", "down"}}, bindTest{"k", "up"}, nil, false},
+		{"different sequences", []bindTest{{"g g", "top"}}, bindTest{"g e", "bottom"}, nil, false},
+		{"same key", []bindTest{{"j", "down"}}, bindTest{"j", "up"}, &ConflictError{"j", "up", "j", "down"}, true},
+		{"same key, same command", []bindTest{{"ctrl+i", "import"}}, bindTest{"tab", "import"}, &ConflictError{"tab", "import", "ctrl+i", "import"}, true},
+		{"prefix of bound", []bindTest{{"g g", "top"}}, bindTest{"g", "go"}, &ConflictError{"g", "go", "g g", "top"}, true},
+		{"bound is prefix", []bindTest{{"j", "down"}, {"g", "go"}}, bindTest{"g g", "top"}, &ConflictError{"g g", "top", "g", "go"}, true},
+		{"invalid key", nil, bindTest{"ctrl+1", "down"}, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			km := New()
+			for _, b := range test.bound {
+				if err := km.Bind(b.spec, b.command); err != nil {
+					t.Fatalf("Bind(%q, %q) returned error: %v", b.spec, b.command, err)
+				}
+			}
+			err := km.Bind(test.bind.spec, test.bind.command)
+			var conflict *ConflictError
+			errors.As(err, &conflict)
+			if (err != nil) != test.wantErr || !reflect.DeepEqual(conflict, test.conflict) {
+				t.Errorf("Bind(%q, %q) returned error %v, want conflict %v", test.bind.spec, test.bind.command, err, test.conflict)
+			}
+		})
+	}
+}
+
+func TestFeed(t *testing.T) {
+	km := New()
+	for spec, command := range map[string]string{
+		"j":             "down",
+		"g g":           "top",
+		"G":             "bottom",
+		"ctrl+x ctrl+s": "save",
+		"z z z":         "center",
+	} {
+		if err := km.Bind(spec, command); err != nil {
+			t.Fatalf("Bind(%q, %q) returned error: %v", spec, command, err)
+		}
+	}
+
+	type step struct {
+		key     window.Key
+		command string
+		pending bool
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"single key", []step{{window.Char('j'), "down", false}}},
+		{"sequence", []step{
+			{window.Char('g'), "", true},
+			{window.Char('g'), "top", false},
+		}},
+		{"modified sequence", []step{
+			{window.Ctrl('x'), "", true},
+			{window.Ctrl('s'), "save", false},
+		}},
+		{"three keys", []step{
+			{window.Char('z'), "", true},
+			{window.Char('z'), "", true},
+			{window.Char('z'), "center", false},
+		}},
+		{"unbound key", []step{{window.Char('x'), "", false}}},
+		{"broken sequence", []step{
+			{window.Char('g'), "", true},
+			{window.Char('x'), "", false},
+			{window.Char('j'), "down", false},
+		}},
+		{"key that breaks a sequence runs its own command", []step{
+			{window.Char('g'), "", true},
+			{window.Char('j'), "down", false},
+		}},
+		{"key that breaks a sequence starts another", []step{
+			{window.Char('z'), "", true},
+			{window.Char('g'), "", true},
+			{window.Char('g'), "top", false},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			km.Reset()
+			for i, s := range test.steps {
+				command, pending := km.Feed(s.key)
+				if command != s.command || pending != s.pending {
+					t.Fatalf("step %d: Feed(%v) = %q, %v; want %q, %v", i, s.key, command, pending, s.command, s.pending)
+				}
+				if pending != (len(km.Pending()) > 0) {
+					t.Errorf("step %d: Pending() = %v after Feed() returned pending %v", i, km.Pending(), pending)
+				}
+			}
+		})
+	}
+
+	km.Feed(window.Char('g'))
+	km.Reset()
+	if command, pending := km.Feed(window.Char('g')); command != "" || !pending {
+		t.Errorf("Feed() after Reset() = %q, %v; want a new sequence", command, pending)
+	}
+}
@@ -0,0 +1,231 @@
+// Package keyspec parses key specs, the way keys are written in the config
+// file & shown in help, e.g. "j", "ctrl+n", "pgdn" or "g g".
+package keyspec
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type Modifier int
+
+const (
+	MOD_SHIFT Modifier = 1 << iota
+	MOD_ALT
+	MOD_CTRL
+)
+
+// Key is a single key of a spec: a character or one of the named keys, e.g.
+// "enter", with modifiers.
+type Key struct {
+	// Name of the key, or "" for a character
+	Name string
+	Rune rune
+	Mod  Modifier
+}
+
+// namedKeys are the keys that can be given by name in a key spec.
+var namedKeys = []struct {
+	name  string
+	label string
+}{
+	{"enter", "Enter"},
+	{"tab", "Tab"},
+	{"esc", "Esc"},
+	{"backspace", "Backspace"},
+	{"insert", "Insert"},
+	{"delete", "Delete"},
+	{"up", "Up"},
+	{"down", "Down"},
+	{"right", "Right"},
+	{"left", "Left"},
+	{"home", "Home"},
+	{"end", "End"},
+	{"pgup", "PgUp"},
+	{"pgdn", "PgDn"},
+	{"f1", "F1"},
+	{"f2", "F2"},
+	{"f3", "F3"},
+	{"f4", "F4"},
+	{"f5", "F5"},
+	{"f6", "F6"},
+	{"f7", "F7"},
+	{"f8", "F8"},
+	{"f9", "F9"},
+	{"f10", "F10"},
+	{"f11", "F11"},
+	{"f12", "F12"},
+	{"wheelup", "WheelUp"},
+	{"wheeldown", "WheelDown"},
+}
+
+var modifierNames = []struct {
+	name  string
+	label string
+	mod   Modifier
+}{
+	{"ctrl", "CTRL", MOD_CTRL},
+	{"alt", "Alt", MOD_ALT},
+	{"shift", "Shift", MOD_SHIFT},
+}
+
+// Names returns the names of the named keys.
+func Names() []string {
+	names := []string{}
+	for _, n := range namedKeys {
+		names = append(names, n.name)
+	}
+	return names
+}
+
+// splitKey splits the spec of a single key into its modifiers & key, e.g.
+// "ctrl+n" into ["ctrl"] & "n".
+func splitKey(spec string) ([]string, string) {
+	if utf8.RuneCountInString(spec) == 1 {
+		return nil, spec
+	}
+	// "+" itself can have modifiers, e.g. "alt++"
+	if rest, ok := strings.CutSuffix(spec, "++"); ok {
+		return strings.Split(rest, "+"), "+"
+	}
+	parts := strings.Split(spec, "+")
+	return parts[:len(parts)-1], parts[len(parts)-1]
+}
+
+// splitSequence splits a spec into the specs of its keys.
+func splitSequence(spec string) []string {
+	if spec == " " {
+		return []string{"space"}
+	}
+	return strings.Fields(spec)
+}
+
+// ParseKey parses the spec of a single key: a character (case-sensitive,
+// e.g. "G"), "space" or one of the named keys, e.g. "enter", "pgdn", "f5" or
+// "wheeldown", optionally after modifiers, e.g. "ctrl+n", "shift+tab" or
+// "alt+left".
+func ParseKey(spec string) (Key, error) {
+	mods, name := splitKey(spec)
+	key := Key{}
+	for _, m := range mods {
+		found := false
+		for _, n := range modifierNames {
+			if strings.ToLower(m) == n.name {
+				key.Mod |= n.mod
+				found = true
+			}
+		}
+		if !found {
+			return Key{}, fmt.Errorf("invalid key '%s': unknown modifier '%s'", spec, m)
+		}
+	}
+
+	if utf8.RuneCountInString(name) == 1 {
+		key.Rune = []rune(name)[0]
+	} else if strings.ToLower(name) == "space" {
+		key.Rune = ' '
+	} else {
+		for _, n := range namedKeys {
+			if strings.ToLower(name) == n.name {
+				key.Name = n.name
+			}
+		}
+		if key.Name == "" {
+			return Key{}, fmt.Errorf("invalid key '%s'", spec)
+		}
+	}
+	return normalizeKey(spec, key)
+}
+
+// normalizeKey turns key into what the terminal actually sends for it, e.g.
+// CTRL+I is sent as TAB & SHIFT+A as "A".
+func normalizeKey(spec string, key Key) (Key, error) {
+	if key.Name != "" {
+		return key, nil
+	}
+	if key.Mod&MOD_SHIFT != 0 {
+		if !unicode.IsLetter(key.Rune) {
+			return Key{}, fmt.Errorf("invalid key '%s': shift only works with letters & named keys", spec)
+		}
+		key.Rune, key.Mod = unicode.ToUpper(key.Rune), key.Mod&^MOD_SHIFT
+	}
+	if key.Mod&MOD_CTRL == 0 {
+		return key, nil
+	}
+
+	key.Rune = unicode.ToLower(key.Rune)
+	switch key.Rune {
+	case 'i':
+		return Key{"tab", 0, key.Mod &^ MOD_CTRL}, nil
+	case 'm':
+		return Key{"enter", 0, key.Mod &^ MOD_CTRL}, nil
+	case '[':
+		return Key{"esc", 0, key.Mod &^ MOD_CTRL}, nil
+	}
+	if (key.Rune < 'a' || key.Rune > 'z') && !strings.ContainsRune(" \\]^_", key.Rune) {
+		return Key{}, fmt.Errorf("invalid key '%s': terminals can't send CTRL with '%c'", spec, key.Rune)
+	}
+	return key, nil
+}
+
+// Parse parses a spec of one or more keys as accepted by ParseKey, separated
+// by spaces, e.g. "ctrl+n", "shift+tab" or "g g".
+func Parse(spec string) ([]Key, error) {
+	specs := splitSequence(spec)
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("invalid key '%s'", spec)
+	}
+	keys := []Key{}
+	for _, s := range specs {
+		key, err := ParseKey(s)
+		if err != nil && len(specs) == 1 {
+			return nil, err
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid key '%s' in '%s'", s, spec)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// KeyLabel returns how to show the spec of a single key (see ParseKey) in
+// help text, e.g. "CTRL+N" or "PgUp".
+func KeyLabel(spec string) string {
+	mods, name := splitKey(spec)
+	label := ""
+	for _, m := range mods {
+		for _, n := range modifierNames {
+			if strings.ToLower(m) == n.name {
+				label += n.label + "+"
+			}
+		}
+	}
+	if strings.ToLower(name) == "space" {
+		return label + "Space"
+	}
+	for _, n := range namedKeys {
+		if strings.ToLower(name) == n.name {
+			return label + n.label
+		}
+	}
+	if strings.Contains(label, "CTRL") {
+		return label + strings.ToUpper(name)
+	}
+	return label + name
+}
+
+// Label returns how to show a spec in help text, e.g. "CTRL+N" or "g g".
+func Label(spec string) string {
+	specs := splitSequence(spec)
+	for i, s := range specs {
+		specs[i] = KeyLabel(s)
+	}
+	return strings.Join(specs, " ")
+}
+
+// Mouse returns true if the key is the mouse wheel.
+func (k Key) Mouse() bool {
+	return k.Name == "wheelup" || k.Name == "wheeldown"
+}
@@ -0,0 +1,88 @@
+package keyspec
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Key
+		wantErr bool
+	}{
+		{"j", Key{Rune: 'j'}, false},
+		{"G", Key{Rune: 'G'}, false},
+		{"+", Key{Rune: '+'}, false},
+		{"space", Key{Rune: ' '}, false},
+		{"PgDn", Key{Name: "pgdn"}, false},
+		{"ctrl+n", Key{Rune: 'n', Mod: MOD_CTRL}, false},
+		{"CTRL+N", Key{Rune: 'n', Mod: MOD_CTRL}, false},
+		{"alt++", Key{Rune: '+', Mod: MOD_ALT}, false},
+		{"shift+tab", Key{Name: "tab", Mod: MOD_SHIFT}, false},
+		{"alt+shift+left", Key{Name: "left", Mod: MOD_ALT | MOD_SHIFT}, false},
+		// What the terminal sends
+		{"shift+a", Key{Rune: 'A'}, false},
+		{"ctrl+i", Key{Name: "tab"}, false},
+		{"ctrl+m", Key{Name: "enter"}, false},
+		{"ctrl+[", Key{Name: "esc"}, false},
+		{"alt+ctrl+i", Key{Name: "tab", Mod: MOD_ALT}, false},
+		{"ctrl+space", Key{Rune: ' ', Mod: MOD_CTRL}, false},
+		{"ctrl+1", Key{}, true},
+		{"shift+1", Key{}, true},
+		{"hyper+x", Key{}, true},
+		{"pgdown", Key{}, true},
+		{"", Key{}, true},
+	}
+	for _, test := range tests {
+		got, err := ParseKey(test.spec)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("ParseKey(%q) = %+v, %v; want %+v, error %v", test.spec, got, err, test.want, test.wantErr)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []Key
+		wantErr string
+	}{
+		{"g g", []Key{{Rune: 'g'}, {Rune: 'g'}}, ""},
+		{" ", []Key{{Rune: ' '}}, ""},
+		{"ctrl+x  ctrl+s", []Key{{Rune: 'x', Mod: MOD_CTRL}, {Rune: 's', Mod: MOD_CTRL}}, ""},
+		{"ctrl+1", nil, "invalid key 'ctrl+1': terminals can't send CTRL with '1'"},
+		{"g ctrl+1", nil, "invalid key 'ctrl+1' in 'g ctrl+1'"},
+		{"", nil, "invalid key ''"},
+	}
+	for _, test := range tests {
+		got, err := Parse(test.spec)
+		if test.wantErr != "" {
+			if err == nil || err.Error() != test.wantErr {
+				t.Errorf("Parse(%q) returned error %v, want %q", test.spec, err, test.wantErr)
+			}
+		} else if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Parse(%q) = %+v, %v; want %+v", test.spec, got, err, test.want)
+		}
+	}
+}
+
+func TestLabel(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"j", "j"},
+		{"ctrl+n", "CTRL+N"},
+		{"shift+tab", "Shift+Tab"},
+		{"pgup", "PgUp"},
+		{" ", "Space"},
+		{"g g", "g g"},
+		{"alt+wheeldown", "Alt+WheelDown"},
+	}
+	for _, test := range tests {
+		if got := Label(test.spec); got != test.want {
+			t.Errorf("Label(%q) = %q, want %q", test.spec, got, test.want)
+		}
+	}
+}
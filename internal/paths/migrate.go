@@ -0,0 +1,149 @@
+package paths
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Left in LegacyDir once it has been migrated, if anything else is left in it
+const MIGRATED_MARKER = ".migrated"
+
+// LegacyDir is where everything was kept before the XDG directories were
+// used.
+func LegacyDir() string {
+	return filepath.Join(os.Getenv("HOME"), ".notes-term")
+}
+
+// MigrateLegacyDir moves the config file, saved logins & drafts out of
+// LegacyDir into the XDG directories, then removes LegacyDir if nothing else
+// is left in it. Anything whose new location already exists is left where it
+// is & reported in the returned error. It does nothing if LegacyDir doesn't
+// exist or has already been migrated, so reports each problem once.
+func MigrateLegacyDir() error {
+	legacy := LegacyDir()
+	if _, err := os.Stat(legacy); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(legacy, MIGRATED_MARKER)); err == nil {
+		return nil
+	}
+
+	moves := [][2]string{
+		{"config.toml", filepath.Join(ConfigDir(), "config.toml")},
+	}
+	moves = append(moves, profileMoves("")...)
+	profiles, err := os.ReadDir(filepath.Join(legacy, "profiles"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for _, p := range profiles {
+		if p.IsDir() {
+			moves = append(moves, profileMoves(filepath.Join("profiles", p.Name()))...)
+		}
+	}
+
+	skipped := []error{}
+	for _, m := range moves {
+		from, to := filepath.Join(legacy, m[0]), m[1]
+		if _, err := os.Lstat(from); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if _, err := os.Lstat(to); err == nil {
+			skipped = append(skipped, fmt.Errorf("left %s where it is, since %s already exists", from, to))
+			continue
+		}
+		if _, err := ensureFolder(filepath.Dir(to)); err != nil {
+			return err
+		}
+		if err := move(from, to); err != nil {
+			return fmt.Errorf("could not move %s to %s: %w", from, to, err)
+		}
+	}
+
+	removeEmptyDirs(legacy)
+	if _, err := os.Stat(legacy); err == nil {
+		os.WriteFile(filepath.Join(legacy, MIGRATED_MARKER), []byte{}, 0600)
+	}
+	return errors.Join(skipped...)
+}
+
+// profileMoves lists what to move out of the profile folder at rel, relative
+// to LegacyDir. Profile folders are laid out the same way in the new
+// directories.
+func profileMoves(rel string) [][2]string {
+	return [][2]string{
+		{filepath.Join(rel, "token"), filepath.Join(DataDir(), rel, "token")},
+		{filepath.Join(rel, "token.enc"), filepath.Join(DataDir(), rel, "token.enc")},
+		{filepath.Join(rel, "drafts"), filepath.Join(StateDir(), rel, "drafts")},
+	}
+}
+
+// move renames from to to, copying across filesystems if need be.
+func move(from string, to string) error {
+	err := os.Rename(from, to)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if err = copyAll(from, to); err != nil {
+		os.RemoveAll(to)
+		return err
+	}
+	return os.RemoveAll(from)
+}
+
+func copyAll(from string, to string) error {
+	return filepath.WalkDir(from, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(from, path)
+		dest := filepath.Join(to, rel)
+		if d.IsDir() {
+			return os.MkdirAll(dest, 0700)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return copyFile(path, dest, info.Mode().Perm())
+	})
+}
+
+func copyFile(from string, to string, perm fs.FileMode) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// removeEmptyDirs removes dir & any folders under it that are (or become)
+// empty.
+func removeEmptyDirs(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			removeEmptyDirs(filepath.Join(dir, e.Name()))
+		}
+	}
+	// Fails if anything is left, which is what we want
+	os.Remove(dir)
+}
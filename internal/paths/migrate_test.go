@@ -0,0 +1,100 @@
+package paths
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeHome points $HOME at a temporary folder & clears the XDG variables.
+func fakeHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	for _, v := range []string{"XDG_CONFIG_HOME", "XDG_STATE_HOME", "XDG_CACHE_HOME", "XDG_DATA_HOME"} {
+		t.Setenv(v, "")
+	}
+	return home
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Errorf("could not read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestMigrateLegacyDir(t *testing.T) {
+	fakeHome(t)
+	legacy := LegacyDir()
+	writeFile(t, filepath.Join(legacy, "config.toml"), "config")
+	writeFile(t, filepath.Join(legacy, "token"), "token")
+	writeFile(t, filepath.Join(legacy, "drafts", "abc"), "draft")
+	writeFile(t, filepath.Join(legacy, "profiles", "work", "token.enc"), "work token")
+
+	if err := MigrateLegacyDir(); err != nil {
+		t.Fatalf("MigrateLegacyDir() returned error: %v", err)
+	}
+	for path, want := range map[string]string{
+		filepath.Join(ConfigDir(), "config.toml"):                 "config",
+		filepath.Join(DataDir(), "token"):                         "token",
+		filepath.Join(StateDir(), "drafts", "abc"):                "draft",
+		filepath.Join(DataDir(), "profiles", "work", "token.enc"): "work token",
+	} {
+		if got := readFile(t, path); got != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Errorf("%s still exists after migrating everything", legacy)
+	}
+}
+
+func TestMigrateLegacyDirReportsOnce(t *testing.T) {
+	fakeHome(t)
+	legacy := LegacyDir()
+	writeFile(t, filepath.Join(legacy, "token"), "old token")
+	writeFile(t, filepath.Join(legacy, "config.toml"), "config")
+	writeFile(t, filepath.Join(DataDir(), "token"), "new token")
+
+	if err := MigrateLegacyDir(); err == nil {
+		t.Error("MigrateLegacyDir() didn't report the token it couldn't move")
+	}
+	if got := readFile(t, filepath.Join(DataDir(), "token")); got != "new token" {
+		t.Errorf("existing token was replaced with %q", got)
+	}
+	if got := readFile(t, filepath.Join(ConfigDir(), "config.toml")); got != "config" {
+		t.Errorf("config.toml = %q, want %q", got, "config")
+	}
+	if got := readFile(t, filepath.Join(legacy, "token")); got != "old token" {
+		t.Errorf("token left behind = %q, want %q", got, "old token")
+	}
+
+	// The next run has nothing new to say
+	if err := MigrateLegacyDir(); err != nil {
+		t.Errorf("second MigrateLegacyDir() returned error: %v", err)
+	}
+}
+
+func TestMigrateLegacyDirMissing(t *testing.T) {
+	home := fakeHome(t)
+	if err := MigrateLegacyDir(); err != nil {
+		t.Errorf("MigrateLegacyDir() without a legacy folder returned error: %v", err)
+	}
+	entries, _ := os.ReadDir(home)
+	if len(entries) != 0 {
+		t.Errorf("MigrateLegacyDir() without a legacy folder created %d entries in $HOME", len(entries))
+	}
+}
@@ -5,10 +5,92 @@ import (
 	"path/filepath"
 )
 
-func EnsureLocalCacheFolder() (string, error) {
-	var path = filepath.Join(os.Getenv("HOME"), ".notes-term")
-	if err := os.MkdirAll(path, 0770); err != nil {
+const (
+	DEFAULT_PROFILE = "default"
+	APP_DIR         = "notes-term"
+)
+
+var (
+	activeProfile = DEFAULT_PROFILE
+)
+
+// xdgDir returns $<envVar>/notes-term, or ~/<fallback>/notes-term if the
+// variable isn't set or isn't absolute, as the XDG Base Directory spec says.
+func xdgDir(envVar string, fallback string) string {
+	base := os.Getenv(envVar)
+	if !filepath.IsAbs(base) {
+		base = filepath.Join(os.Getenv("HOME"), fallback)
+	}
+	return filepath.Join(base, APP_DIR)
+}
+
+// ConfigDir holds the config file.
+func ConfigDir() string {
+	return xdgDir("XDG_CONFIG_HOME", ".config")
+}
+
+// StateDir holds drafts & other state worth keeping between runs, but not
+// worth backing up.
+func StateDir() string {
+	return xdgDir("XDG_STATE_HOME", filepath.Join(".local", "state"))
+}
+
+// CacheDir holds data that can be thrown away & fetched again, e.g. note
+// content.
+func CacheDir() string {
+	return xdgDir("XDG_CACHE_HOME", ".cache")
+}
+
+// DataDir holds saved logins.
+func DataDir() string {
+	return xdgDir("XDG_DATA_HOME", filepath.Join(".local", "share"))
+}
+
+func ensureFolder(path string) (string, error) {
+	if err := os.MkdirAll(path, 0700); err != nil {
 		return "", err
 	}
 	return path, nil
 }
+
+// EnsureStateFolder returns the state folder shared by all profiles, e.g.
+// for the log.
+func EnsureStateFolder() (string, error) {
+	return ensureFolder(StateDir())
+}
+
+// SetProfile changes the profile whose folders the EnsureProfile* functions
+// return.
+func SetProfile(name string) {
+	activeProfile = name
+}
+
+func ActiveProfile() string {
+	return activeProfile
+}
+
+// profileDir returns the active profile's folder under root. The default
+// profile uses root itself; others get a folder under profiles/.
+func profileDir(root string) string {
+	if activeProfile == DEFAULT_PROFILE {
+		return root
+	}
+	return filepath.Join(root, "profiles", activeProfile)
+}
+
+// EnsureProfileStateFolder returns the folder for the active profile's drafts.
+func EnsureProfileStateFolder() (string, error) {
+	return ensureFolder(profileDir(StateDir()))
+}
+
+// EnsureProfileCacheFolder returns the active profile's cache folder, e.g. for
+// note contents.
+func EnsureProfileCacheFolder() (string, error) {
+	return ensureFolder(profileDir(CacheDir()))
+}
+
+// EnsureProfileDataFolder returns the folder for the active profile's saved
+// login.
+func EnsureProfileDataFolder() (string, error) {
+	return ensureFolder(profileDir(DataDir()))
+}
@@ -0,0 +1,8 @@
+package window
+
+// NewPalette returns a palette from background & foreground colors, given as
+// offsets from the base SGR code (30 for foreground, 40 for background),
+// e.g. 6 for cyan or 66 for bright cyan.
+func NewPalette(background int, foreground int) *Palette {
+	return &Palette{40 + background, 30 + foreground}
+}
@@ -0,0 +1,454 @@
+package window
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	unix "golang.org/x/sys/unix"
+	"mrshanahan.com/notes-term/internal/keyspec"
+)
+
+// KeyCode says which key a Key is. Characters are all KEY_RUNE, with the
+// character in Key.Rune.
+type KeyCode int
+
+const (
+	KEY_UNKNOWN KeyCode = iota
+	KEY_RUNE
+	KEY_ENTER
+	KEY_TAB
+	KEY_BACKSPACE
+	KEY_ESC
+	KEY_INSERT
+	KEY_DELETE
+	KEY_UP
+	KEY_DOWN
+	KEY_RIGHT
+	KEY_LEFT
+	KEY_HOME
+	KEY_END
+	KEY_PGUP
+	KEY_PGDN
+	KEY_F1
+	KEY_F2
+	KEY_F3
+	KEY_F4
+	KEY_F5
+	KEY_F6
+	KEY_F7
+	KEY_F8
+	KEY_F9
+	KEY_F10
+	KEY_F11
+	KEY_F12
+	// The mouse, reported when mouse reporting is on (see EnableMouse). Where
+	// it happened is given by MousePosition.
+	KEY_WHEEL_UP
+	KEY_WHEEL_DOWN
+	// The left button being pressed; a second press in the same place within
+	// DOUBLE_CLICK_TIMEOUT is KEY_DOUBLE_CLICK instead
+	KEY_CLICK
+	KEY_DOUBLE_CLICK
+
+	// Synthetic keys returned by ReadKey
+
+	// The terminal has been resized
+	KEY_RESIZE
+	// Something happened in the background (see PostRefresh) & the screen
+	// should be redrawn
+	KEY_REFRESH
+
+	// A mouse event nothing uses, e.g. a button being released. ReadKey skips
+	// these.
+	keyMouseIgnored
+)
+
+// Modifier is a set of modifier keys held down with a key.
+type Modifier int
+
+const (
+	MOD_SHIFT Modifier = 1 << iota
+	MOD_ALT
+	MOD_CTRL
+)
+
+// How long to wait for the rest of an escape sequence before deciding ESC
+// was pressed on its own
+const ESC_TIMEOUT = 50 * time.Millisecond
+
+// How soon a second click has to follow the first to be a double-click
+const DOUBLE_CLICK_TIMEOUT = 400 * time.Millisecond
+
+// Key is a decoded key press. Keys are comparable, so can be used in switch
+// cases & as map keys.
+type Key struct {
+	Code KeyCode
+	Rune rune
+	Mod  Modifier
+}
+
+// Ctrl returns the key for CTRL plus the given (lowercase) character.
+func Ctrl(r rune) Key {
+	return Key{KEY_RUNE, r, MOD_CTRL}
+}
+
+// Char returns the key for a character typed without modifiers.
+func Char(r rune) Key {
+	return Key{KEY_RUNE, r, 0}
+}
+
+// Mouse returns true if the key comes from the mouse rather than the
+// keyboard.
+func (k Key) Mouse() bool {
+	switch k.Code {
+	case KEY_WHEEL_UP, KEY_WHEEL_DOWN, KEY_CLICK, KEY_DOUBLE_CLICK:
+		return true
+	}
+	return false
+}
+
+// Printable returns true if the key types a character, i.e. it's a printable
+// character without CTRL or ALT.
+func (k Key) Printable() bool {
+	return k.Code == KEY_RUNE && k.Mod&(MOD_CTRL|MOD_ALT) == 0 && unicode.IsPrint(k.Rune)
+}
+
+func (k Key) String() string {
+	prefix := ""
+	if k.Mod&MOD_CTRL != 0 {
+		prefix += "CTRL+"
+	}
+	if k.Mod&MOD_ALT != 0 {
+		prefix += "Alt+"
+	}
+	if k.Mod&MOD_SHIFT != 0 {
+		prefix += "Shift+"
+	}
+	if k.Code == KEY_RUNE {
+		if k.Rune == ' ' {
+			return prefix + "Space"
+		}
+		if k.Mod&MOD_CTRL != 0 {
+			return prefix + string(unicode.ToUpper(k.Rune))
+		}
+		return prefix + string(k.Rune)
+	}
+	for name, code := range namedKeys {
+		if code == k.Code {
+			return prefix + keyspec.KeyLabel(name)
+		}
+	}
+	switch k.Code {
+	case KEY_CLICK:
+		return prefix + "Click"
+	case KEY_DOUBLE_CLICK:
+		return prefix + "DoubleClick"
+	}
+	return prefix + "?"
+}
+
+var (
+	// Bytes read from stdin but not yet decoded
+	pendingInput []byte
+
+	// Where the last mouse key happened
+	mouseRow, mouseCol int
+	// The last click, for spotting double-clicks
+	lastClickRow, lastClickCol int
+	lastClickAt                time.Time
+)
+
+// ReadKey blocks until a key is pressed (or a notification arrives; see
+// ListenForResize & PostRefresh) & returns it.
+func ReadKey() Key {
+	for {
+		if len(pendingInput) == 0 {
+			if key, ok := waitForInput(); ok {
+				return key
+			}
+			if !readInput(-1) {
+				return Key{Code: KEY_UNKNOWN}
+			}
+		}
+		key := nextKey()
+		if key.Code == KEY_CLICK {
+			key = checkDoubleClick(key)
+		}
+		if key.Code != keyMouseIgnored {
+			return key
+		}
+	}
+}
+
+// MousePosition returns the screen row & column (as given to Move) of the
+// last mouse key ReadKey returned.
+func MousePosition() (int, int) {
+	return mouseRow, mouseCol
+}
+
+// nextKey decodes the next key from pendingInput, waiting briefly for the
+// rest of it if it's incomplete.
+func nextKey() Key {
+	for {
+		key, n, complete := decodeKey(pendingInput)
+		// An incomplete sequence is taken as-is if nothing follows in time
+		if complete || !readInput(ESC_TIMEOUT) {
+			pendingInput = pendingInput[n:]
+			return key
+		}
+	}
+}
+
+// checkDoubleClick turns click into a double-click if it closely follows
+// another in the same place.
+func checkDoubleClick(click Key) Key {
+	now := time.Now()
+	if mouseRow == lastClickRow && mouseCol == lastClickCol && now.Sub(lastClickAt) <= DOUBLE_CLICK_TIMEOUT {
+		// A third click starts over
+		lastClickAt = time.Time{}
+		click.Code = KEY_DOUBLE_CLICK
+		return click
+	}
+	lastClickRow, lastClickCol, lastClickAt = mouseRow, mouseCol, now
+	return click
+}
+
+// readInput appends whatever is available on stdin to pendingInput, waiting
+// at most timeout for it (forever if negative). Returns false if nothing was
+// read.
+func readInput(timeout time.Duration) bool {
+	if timeout >= 0 {
+		fds := []unix.PollFd{{Fd: int32(os.Stdin.Fd()), Events: unix.POLLIN}}
+		n, err := unix.Poll(fds, int(timeout.Milliseconds()))
+		if err != nil || n == 0 {
+			return false
+		}
+	}
+	buf := make([]byte, 256)
+	n, err := os.Stdin.Read(buf)
+	if err != nil || n == 0 {
+		return false
+	}
+	pendingInput = append(pendingInput, buf[:n]...)
+	return true
+}
+
+// decodeKey decodes the key at the start of buf, returning it & how many
+// bytes it took. If buf might be the start of a longer sequence, complete is
+// false & the key is what buf means if no more input arrives.
+func decodeKey(buf []byte) (key Key, n int, complete bool) {
+	b := buf[0]
+	switch {
+	case b == 0x1b:
+		if len(buf) == 1 {
+			return Key{Code: KEY_ESC}, 1, false
+		}
+		switch buf[1] {
+		case '[':
+			return decodeCSI(buf)
+		case 'O':
+			return decodeSS3(buf)
+		case 0x1b:
+			return Key{Code: KEY_ESC}, 1, true
+		}
+		// ESC before a key means ALT was held
+		key, n, complete = decodeKey(buf[1:])
+		key.Mod |= MOD_ALT
+		return key, n + 1, complete
+	case b == 0x0d:
+		return Key{Code: KEY_ENTER}, 1, true
+	case b == 0x09:
+		return Key{Code: KEY_TAB}, 1, true
+	case b == 0x7f:
+		return Key{Code: KEY_BACKSPACE}, 1, true
+	case b == 0x00:
+		return Ctrl(' '), 1, true
+	case b <= 0x1a:
+		return Ctrl(rune('a' + b - 1)), 1, true
+	case b < 0x20:
+		// CTRL+\, CTRL+], CTRL+^ & CTRL+_
+		return Ctrl(rune('\\' + b - 0x1c)), 1, true
+	}
+
+	if !utf8.FullRune(buf) {
+		return Char(utf8.RuneError), len(buf), false
+	}
+	r, size := utf8.DecodeRune(buf)
+	return Char(r), size, true
+}
+
+// csiKeys are the keys sent as ESC [ <modifiers> <final>.
+var csiKeys = map[byte]KeyCode{
+	'A': KEY_UP,
+	'B': KEY_DOWN,
+	'C': KEY_RIGHT,
+	'D': KEY_LEFT,
+	'H': KEY_HOME,
+	'F': KEY_END,
+	'P': KEY_F1,
+	'Q': KEY_F2,
+	'R': KEY_F3,
+	'S': KEY_F4,
+}
+
+// tildeKeys are the keys sent as ESC [ <number> ; <modifiers> ~.
+var tildeKeys = map[int]KeyCode{
+	1:  KEY_HOME,
+	2:  KEY_INSERT,
+	3:  KEY_DELETE,
+	4:  KEY_END,
+	5:  KEY_PGUP,
+	6:  KEY_PGDN,
+	7:  KEY_HOME,
+	8:  KEY_END,
+	11: KEY_F1,
+	12: KEY_F2,
+	13: KEY_F3,
+	14: KEY_F4,
+	15: KEY_F5,
+	17: KEY_F6,
+	18: KEY_F7,
+	19: KEY_F8,
+	20: KEY_F9,
+	21: KEY_F10,
+	23: KEY_F11,
+	24: KEY_F12,
+}
+
+// decodeCSI decodes a control sequence, ESC [ <params> <final>. Sequences we
+// don't know are consumed & returned as KEY_UNKNOWN.
+func decodeCSI(buf []byte) (Key, int, bool) {
+	end := -1
+	for i := 2; i < len(buf); i++ {
+		if buf[i] >= 0x40 && buf[i] <= 0x7e {
+			end = i
+			break
+		} else if buf[i] < 0x20 || buf[i] > 0x3f {
+			// Not a valid sequence; take the ESC on its own
+			return Key{Code: KEY_ESC}, 1, true
+		}
+	}
+	if end < 0 {
+		return Key{KEY_RUNE, '[', MOD_ALT}, 2, false
+	}
+
+	if end == 2 && buf[2] == 'M' {
+		return decodeX10Mouse(buf)
+	}
+
+	params := strings.Split(string(buf[2:end]), ";")
+	key := Key{Code: KEY_UNKNOWN}
+	switch final := buf[end]; {
+	case strings.HasPrefix(params[0], "<") && (final == 'M' || final == 'm'):
+		return decodeSGRMouse(params, final == 'm'), end + 1, true
+	case final == 'Z':
+		key = Key{KEY_TAB, 0, MOD_SHIFT}
+	case final == '~':
+		number, _ := strconv.Atoi(params[0])
+		if code, ok := tildeKeys[number]; ok {
+			key.Code = code
+		}
+	default:
+		if code, ok := csiKeys[final]; ok {
+			key.Code = code
+		}
+	}
+	if key.Code != KEY_UNKNOWN && len(params) > 1 {
+		key.Mod |= decodeModifiers(params[1])
+	}
+	return key, end + 1, true
+}
+
+// decodeSGRMouse decodes an SGR mouse report, ESC [ < <button> ; <x> ; <y> M
+// (or m on release).
+func decodeSGRMouse(params []string, release bool) Key {
+	if len(params) != 3 {
+		return Key{Code: keyMouseIgnored}
+	}
+	button, err := strconv.Atoi(strings.TrimPrefix(params[0], "<"))
+	col, colErr := strconv.Atoi(params[1])
+	row, rowErr := strconv.Atoi(params[2])
+	if err != nil || colErr != nil || rowErr != nil {
+		return Key{Code: keyMouseIgnored}
+	}
+	return decodeMouse(button, col, row, release)
+}
+
+// decodeX10Mouse decodes a mouse report in the older encoding, ESC [ M
+// <button> <x> <y>, each a byte offset by 32, which terminals without SGR
+// reports send instead. It can't say which button was released, so the
+// button is 3 for any release.
+func decodeX10Mouse(buf []byte) (Key, int, bool) {
+	if len(buf) < 6 {
+		// Swallowed if the rest doesn't arrive
+		return Key{Code: keyMouseIgnored}, len(buf), false
+	}
+	button := int(buf[3]) - 32
+	release := button&64 == 0 && button&3 == 3
+	return decodeMouse(button, int(buf[4])-32, int(buf[5])-32, release), 6, true
+}
+
+// decodeMouse decodes the button of a mouse report, recording where it
+// happened. Only the wheel & left clicks are reported as keys.
+func decodeMouse(button int, col int, row int, release bool) Key {
+	mouseRow, mouseCol = row, col
+
+	key := Key{Code: keyMouseIgnored}
+	switch {
+	case release || button&32 != 0:
+		// Releases & drags
+	case button&64 != 0 && button&3 == 0:
+		key.Code = KEY_WHEEL_UP
+	case button&64 != 0 && button&3 == 1:
+		key.Code = KEY_WHEEL_DOWN
+	case button&64 == 0 && button&3 == 0:
+		key.Code = KEY_CLICK
+	}
+	if button&4 != 0 {
+		key.Mod |= MOD_SHIFT
+	}
+	if button&8 != 0 {
+		key.Mod |= MOD_ALT
+	}
+	if button&16 != 0 {
+		key.Mod |= MOD_CTRL
+	}
+	return key
+}
+
+// decodeSS3 decodes ESC O <final>, which some terminals send for arrows,
+// Home/End & F1-F4.
+func decodeSS3(buf []byte) (Key, int, bool) {
+	if len(buf) < 3 {
+		return Key{KEY_RUNE, 'O', MOD_ALT}, 2, false
+	}
+	if code, ok := csiKeys[buf[2]]; ok {
+		return Key{Code: code}, 3, true
+	}
+	return Key{Code: KEY_UNKNOWN}, 3, true
+}
+
+// decodeModifiers decodes the xterm modifier parameter: 1 plus a bit mask of
+// shift (1), alt (2) & ctrl (4).
+func decodeModifiers(param string) Modifier {
+	n, err := strconv.Atoi(param)
+	if err != nil || n < 1 {
+		return 0
+	}
+	bits := n - 1
+	mod := Modifier(0)
+	if bits&1 != 0 {
+		mod |= MOD_SHIFT
+	}
+	if bits&2 != 0 {
+		mod |= MOD_ALT
+	}
+	if bits&4 != 0 {
+		mod |= MOD_CTRL
+	}
+	return mod
+}
@@ -0,0 +1,136 @@
+package window
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+type decodeTest struct {
+	name     string
+	input    string
+	want     Key
+	n        int
+	complete bool
+}
+
+func runDecodeTests(t *testing.T, name string, decode func([]byte) (Key, int, bool), tests []decodeTest) {
+	t.Helper()
+	for _, test := range tests {
+		key, n, complete := decode([]byte(test.input))
+		if key != test.want || n != test.n || complete != test.complete {
+			t.Errorf("%s: %s(%q) = %+v, %d, %v; want %+v, %d, %v", test.name, name, test.input, key, n, complete, test.want, test.n, test.complete)
+		}
+	}
+}
+
+func TestDecodeKey(t *testing.T) {
+	runDecodeTests(t, "decodeKey", decodeKey, []decodeTest{
+		{"character", "j", Char('j'), 1, true},
+		{"only the first key", "jk", Char('j'), 1, true},
+		{"UTF-8", "é!", Char('é'), 2, true},
+		{"partial UTF-8", "\xe6\x97", Char(utf8.RuneError), 2, false},
+		{"enter", "\r", Key{Code: KEY_ENTER}, 1, true},
+		{"tab", "\t", Key{Code: KEY_TAB}, 1, true},
+		{"backspace", "\x7f", Key{Code: KEY_BACKSPACE}, 1, true},
+		{"ctrl+space", "\x00", Ctrl(' '), 1, true},
+		{"ctrl+a", "\x01", Ctrl('a'), 1, true},
+		{"ctrl+z", "\x1a", Ctrl('z'), 1, true},
+		{"ctrl+backslash", "\x1c", Ctrl('\\'), 1, true},
+		{"ctrl+underscore", "\x1f", Ctrl('_'), 1, true},
+		{"lone esc", "\x1b", Key{Code: KEY_ESC}, 1, false},
+		{"esc esc", "\x1b\x1b", Key{Code: KEY_ESC}, 1, true},
+		{"alt+character", "\x1bj", Key{KEY_RUNE, 'j', MOD_ALT}, 2, true},
+		{"alt+ctrl", "\x1b\x01", Key{KEY_RUNE, 'a', MOD_ALT | MOD_CTRL}, 2, true},
+		{"alt+enter", "\x1b\r", Key{KEY_ENTER, 0, MOD_ALT}, 2, true},
+		{"arrow", "\x1b[A", Key{Code: KEY_UP}, 3, true},
+		{"SS3 arrow", "\x1bOB", Key{Code: KEY_DOWN}, 3, true},
+		{"alt+[", "\x1b[", Key{KEY_RUNE, '[', MOD_ALT}, 2, false},
+	})
+}
+
+func TestDecodeCSI(t *testing.T) {
+	runDecodeTests(t, "decodeCSI", decodeCSI, []decodeTest{
+		{"up", "\x1b[A", Key{Code: KEY_UP}, 3, true},
+		{"left", "\x1b[D", Key{Code: KEY_LEFT}, 3, true},
+		{"home", "\x1b[H", Key{Code: KEY_HOME}, 3, true},
+		{"F1", "\x1b[P", Key{Code: KEY_F1}, 3, true},
+		{"shift+tab", "\x1b[Z", Key{KEY_TAB, 0, MOD_SHIFT}, 3, true},
+		{"ctrl+up", "\x1b[1;5A", Key{KEY_UP, 0, MOD_CTRL}, 6, true},
+		{"shift+alt+right", "\x1b[1;4C", Key{KEY_RIGHT, 0, MOD_SHIFT | MOD_ALT}, 6, true},
+		{"delete", "\x1b[3~", Key{Code: KEY_DELETE}, 4, true},
+		{"pgdn", "\x1b[6~", Key{Code: KEY_PGDN}, 4, true},
+		{"F12", "\x1b[24~", Key{Code: KEY_F12}, 5, true},
+		{"ctrl+F5", "\x1b[15;5~", Key{KEY_F5, 0, MOD_CTRL}, 7, true},
+		{"followed by more", "\x1b[Bj", Key{Code: KEY_DOWN}, 3, true},
+		{"unknown tilde", "\x1b[99~", Key{Code: KEY_UNKNOWN}, 5, true},
+		{"unknown final", "\x1b[1;2y", Key{Code: KEY_UNKNOWN}, 6, true},
+		{"incomplete", "\x1b[1;5", Key{KEY_RUNE, '[', MOD_ALT}, 2, false},
+		{"invalid", "\x1b[1\x01", Key{Code: KEY_ESC}, 1, true},
+		{"SGR wheel", "\x1b[<65;10;5M", Key{Code: KEY_WHEEL_DOWN}, 11, true},
+		{"SGR release", "\x1b[<0;10;5m", Key{Code: keyMouseIgnored}, 10, true},
+		{"X10 click", "\x1b[M !+", Key{Code: KEY_CLICK}, 6, true},
+		{"X10 wheel up", "\x1b[M`!+", Key{Code: KEY_WHEEL_UP}, 6, true},
+		{"X10 release", "\x1b[M#!+", Key{Code: keyMouseIgnored}, 6, true},
+		{"X10 followed by more", "\x1b[Ma!+j", Key{Code: KEY_WHEEL_DOWN}, 6, true},
+		{"incomplete X10", "\x1b[M ", Key{Code: keyMouseIgnored}, 4, false},
+	})
+}
+
+func TestDecodeSS3(t *testing.T) {
+	runDecodeTests(t, "decodeSS3", decodeSS3, []decodeTest{
+		{"up", "\x1bOA", Key{Code: KEY_UP}, 3, true},
+		{"end", "\x1bOF", Key{Code: KEY_END}, 3, true},
+		{"F4", "\x1bOS", Key{Code: KEY_F4}, 3, true},
+		{"unknown", "\x1bOx", Key{Code: KEY_UNKNOWN}, 3, true},
+		{"incomplete", "\x1bO", Key{KEY_RUNE, 'O', MOD_ALT}, 2, false},
+	})
+}
+
+func TestDecodeMouse(t *testing.T) {
+	tests := []struct {
+		name    string
+		button  int
+		release bool
+		want    Key
+	}{
+		{"left click", 0, false, Key{Code: KEY_CLICK}},
+		{"left release", 0, true, Key{Code: keyMouseIgnored}},
+		{"middle click", 1, false, Key{Code: keyMouseIgnored}},
+		{"right click", 2, false, Key{Code: keyMouseIgnored}},
+		{"drag", 32, false, Key{Code: keyMouseIgnored}},
+		{"wheel up", 64, false, Key{Code: KEY_WHEEL_UP}},
+		{"wheel down", 65, false, Key{Code: KEY_WHEEL_DOWN}},
+		{"shift+click", 4, false, Key{KEY_CLICK, 0, MOD_SHIFT}},
+		{"alt+wheel down", 65 | 8, false, Key{KEY_WHEEL_DOWN, 0, MOD_ALT}},
+		{"ctrl+wheel up", 64 | 16, false, Key{KEY_WHEEL_UP, 0, MOD_CTRL}},
+	}
+	for _, test := range tests {
+		mouseRow, mouseCol = 0, 0
+		if got := decodeMouse(test.button, 12, 7, test.release); got != test.want {
+			t.Errorf("%s: decodeMouse(%d, %v) = %+v, want %+v", test.name, test.button, test.release, got, test.want)
+		}
+		if mouseRow != 7 || mouseCol != 12 {
+			t.Errorf("%s: mouse position = %d, %d; want 7, 12", test.name, mouseRow, mouseCol)
+		}
+	}
+}
+
+func TestDecodeMouseReports(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		row, col int
+	}{
+		{"SGR", "\x1b[<0;120;45M", 45, 120},
+		// Positions are offset by 32, so column 1 is '!'
+		{"X10", "\x1b[M !\"", 2, 1},
+		{"X10 far right", "\x1b[M \xff!", 1, 223},
+	}
+	for _, test := range tests {
+		mouseRow, mouseCol = 0, 0
+		decodeCSI([]byte(test.input))
+		if mouseRow != test.row || mouseCol != test.col {
+			t.Errorf("%s: mouse position = %d, %d; want %d, %d", test.name, mouseRow, mouseCol, test.row, test.col)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package window
+
+import (
+	"mrshanahan.com/notes-term/internal/keyspec"
+)
+
+// namedKeys are the codes of the keys that can be given by name in a key
+// spec; see keyspec.ParseKey.
+var namedKeys = map[string]KeyCode{
+	"enter":     KEY_ENTER,
+	"tab":       KEY_TAB,
+	"esc":       KEY_ESC,
+	"backspace": KEY_BACKSPACE,
+	"insert":    KEY_INSERT,
+	"delete":    KEY_DELETE,
+	"up":        KEY_UP,
+	"down":      KEY_DOWN,
+	"right":     KEY_RIGHT,
+	"left":      KEY_LEFT,
+	"home":      KEY_HOME,
+	"end":       KEY_END,
+	"pgup":      KEY_PGUP,
+	"pgdn":      KEY_PGDN,
+	"f1":        KEY_F1,
+	"f2":        KEY_F2,
+	"f3":        KEY_F3,
+	"f4":        KEY_F4,
+	"f5":        KEY_F5,
+	"f6":        KEY_F6,
+	"f7":        KEY_F7,
+	"f8":        KEY_F8,
+	"f9":        KEY_F9,
+	"f10":       KEY_F10,
+	"f11":       KEY_F11,
+	"f12":       KEY_F12,
+	"wheelup":   KEY_WHEEL_UP,
+	"wheeldown": KEY_WHEEL_DOWN,
+}
+
+var specModifiers = map[keyspec.Modifier]Modifier{
+	keyspec.MOD_SHIFT: MOD_SHIFT,
+	keyspec.MOD_ALT:   MOD_ALT,
+	keyspec.MOD_CTRL:  MOD_CTRL,
+}
+
+// SpecKey returns the key for a parsed key spec.
+func SpecKey(k keyspec.Key) Key {
+	key := Key{Code: KEY_RUNE, Rune: k.Rune}
+	if k.Name != "" {
+		key = Key{Code: namedKeys[k.Name]}
+	}
+	for specMod, mod := range specModifiers {
+		if k.Mod&specMod != 0 {
+			key.Mod |= mod
+		}
+	}
+	return key
+}
@@ -0,0 +1,34 @@
+package window
+
+import (
+	"testing"
+
+	"mrshanahan.com/notes-term/internal/keyspec"
+)
+
+func TestSpecKey(t *testing.T) {
+	for _, name := range keyspec.Names() {
+		if _, ok := namedKeys[name]; !ok {
+			t.Errorf("no key code for '%s'", name)
+		}
+	}
+	if len(namedKeys) != len(keyspec.Names()) {
+		t.Errorf("%d key codes for %d named keys", len(namedKeys), len(keyspec.Names()))
+	}
+
+	tests := []struct {
+		key  keyspec.Key
+		want Key
+	}{
+		{keyspec.Key{Rune: 'j'}, Char('j')},
+		{keyspec.Key{Rune: 'n', Mod: keyspec.MOD_CTRL}, Ctrl('n')},
+		{keyspec.Key{Name: "tab", Mod: keyspec.MOD_SHIFT}, Key{Code: KEY_TAB, Mod: MOD_SHIFT}},
+		{keyspec.Key{Name: "left", Mod: keyspec.MOD_ALT | keyspec.MOD_CTRL}, Key{Code: KEY_LEFT, Mod: MOD_ALT | MOD_CTRL}},
+		{keyspec.Key{Name: "wheeldown"}, Key{Code: KEY_WHEEL_DOWN}},
+	}
+	for _, test := range tests {
+		if got := SpecKey(test.key); got != test.want {
+			t.Errorf("SpecKey(%+v) = %+v, want %+v", test.key, got, test.want)
+		}
+	}
+}
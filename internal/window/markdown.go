@@ -0,0 +1,383 @@
+package window
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type TextStyle int
+
+const (
+	STYLE_BOLD TextStyle = 1 << iota
+	STYLE_ITALIC
+	STYLE_UNDERLINE
+	STYLE_DIM
+	STYLE_CODE
+)
+
+const (
+	MARKDOWN_BULLET      = "• "
+	MARKDOWN_QUOTE_BAR   = "│ "
+	MARKDOWN_RULE        = '─'
+	MARKDOWN_TAB_WIDTH   = PREVIEW_TAB_WIDTH
+	MARKDOWN_LIST_INDENT = 2
+)
+
+var (
+	headingRegexp  = regexp.MustCompile(`^ {0,3}(#{1,6})\s+(.*?)(\s+#+)?\s*$`)
+	listItemRegexp = regexp.MustCompile(`^(\s*)([-*+]|\d{1,9}[.)])\s+(.*)$`)
+	fenceRegexp    = regexp.MustCompile("^\\s*(```+|~~~+)")
+)
+
+// Span is a run of text drawn with a single style.
+type Span struct {
+	Text  string
+	Style TextStyle
+}
+
+// StyledLine is a single screen line of rendered text. Code block lines are
+// filled to the full width with the code background.
+type StyledLine struct {
+	Spans     []Span
+	CodeBlock bool
+}
+
+// PlainLines wraps text without any Markdown interpretation.
+func PlainLines(text string, width int) []StyledLine {
+	lines := []StyledLine{}
+	for _, l := range WrapText(text, width) {
+		lines = append(lines, StyledLine{Spans: []Span{{l, 0}}})
+	}
+	return lines
+}
+
+// RenderMarkdown renders Markdown text into lines no wider than width.
+// Supports headings, emphasis, inline code, fenced code blocks, bullet &
+// numbered lists, block quotes, horizontal rules & links.
+func RenderMarkdown(text string, width int) []StyledLine {
+	if width <= 0 {
+		return []StyledLine{}
+	}
+
+	text = strings.ReplaceAll(text, "\r", "")
+	text = strings.ReplaceAll(text, "\t", strings.Repeat(" ", MARKDOWN_TAB_WIDTH))
+	text = SanitizeText(text)
+
+	out := []StyledLine{}
+	paragraph := []string{}
+	flush := func() {
+		if len(paragraph) > 0 {
+			out = append(out, wrapSpans(parseInline(strings.Join(paragraph, " "), 0), width, nil, nil)...)
+			paragraph = paragraph[:0]
+		}
+	}
+	blank := func() {
+		if len(out) > 0 && len(out[len(out)-1].Spans) > 0 {
+			out = append(out, StyledLine{})
+		}
+	}
+
+	fence := ""
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+				continue
+			}
+			out = append(out, codeBlockLines(line, width)...)
+			continue
+		}
+
+		if m := fenceRegexp.FindStringSubmatch(line); m != nil {
+			flush()
+			fence = m[1]
+			continue
+		}
+		if trimmed == "" {
+			flush()
+			blank()
+			continue
+		}
+		if m := headingRegexp.FindStringSubmatch(line); m != nil {
+			flush()
+			style := STYLE_BOLD
+			if len(m[1]) <= 2 {
+				style |= STYLE_UNDERLINE
+			}
+			out = append(out, wrapSpans(parseInline(m[2], style), width, nil, nil)...)
+			continue
+		}
+		if isHorizontalRule(trimmed) {
+			flush()
+			out = append(out, StyledLine{Spans: []Span{{strings.Repeat(string(MARKDOWN_RULE), width), STYLE_DIM}}})
+			continue
+		}
+		if strings.HasPrefix(trimmed, ">") {
+			flush()
+			content := strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))
+			prefix := []Span{{MARKDOWN_QUOTE_BAR, STYLE_DIM}}
+			out = append(out, wrapSpans(parseInline(content, STYLE_ITALIC), width, prefix, prefix)...)
+			continue
+		}
+		if m := listItemRegexp.FindStringSubmatch(line); m != nil {
+			flush()
+			indent := strings.Repeat(" ", (len(m[1])/2)*MARKDOWN_LIST_INDENT)
+			marker := m[2] + " "
+			if strings.ContainsAny(m[2], "-*+") {
+				marker = MARKDOWN_BULLET
+			}
+			first := []Span{{indent + marker, 0}}
+			rest := []Span{{indent + strings.Repeat(" ", len([]rune(marker))), 0}}
+			out = append(out, wrapSpans(parseInline(m[3], 0), width, first, rest)...)
+			continue
+		}
+		paragraph = append(paragraph, trimmed)
+	}
+	flush()
+
+	for len(out) > 0 && len(out[len(out)-1].Spans) == 0 {
+		out = out[:len(out)-1]
+	}
+	return out
+}
+
+func isHorizontalRule(trimmed string) bool {
+	s := strings.ReplaceAll(trimmed, " ", "")
+	if len(s) < 3 || !strings.ContainsAny(s[:1], "-*_") {
+		return false
+	}
+	return strings.Trim(s, s[:1]) == ""
+}
+
+func codeBlockLines(line string, width int) []StyledLine {
+	lines := []StyledLine{}
+	for StringWidth(line) > width {
+		head, rest := wrapWidth(line, width)
+		lines = append(lines, StyledLine{[]Span{{head, STYLE_CODE}}, true})
+		line = rest
+	}
+	return append(lines, StyledLine{[]Span{{line, STYLE_CODE}}, true})
+}
+
+// parseInline splits text into spans according to inline Markdown: code,
+// strong & regular emphasis, links & autolinks. Every span also gets base.
+func parseInline(text string, base TextStyle) []Span {
+	spans := []Span{}
+	var plain strings.Builder
+	emit := func(s []Span) {
+		if plain.Len() > 0 {
+			spans = append(spans, Span{plain.String(), base})
+			plain.Reset()
+		}
+		spans = append(spans, s...)
+	}
+
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\\' && i+1 < len(text) && strings.IndexByte("\\`*_[]()<>#+-.!", text[i+1]) >= 0:
+			plain.WriteByte(text[i+1])
+			i += 2
+			continue
+		case c == '`':
+			ticks := len(text[i:]) - len(strings.TrimLeft(text[i:], "`"))
+			delim := text[i : i+ticks]
+			if end := strings.Index(text[i+ticks:], delim); end >= 0 {
+				code := strings.TrimSpace(text[i+ticks : i+ticks+end])
+				emit([]Span{{code, base | STYLE_CODE}})
+				i += ticks + end + ticks
+				continue
+			}
+		case (c == '*' || c == '_') && i+1 < len(text) && text[i+1] == c:
+			delim := text[i : i+2]
+			if end := strings.Index(text[i+2:], delim); end > 0 {
+				emit(parseInline(text[i+2:i+2+end], base|STYLE_BOLD))
+				i += 2 + end + 2
+				continue
+			}
+		case c == '*' || (c == '_' && (i == 0 || !isWordByte(text[i-1]))):
+			if end := findClosingEmphasis(text, i+1, c); end > 0 {
+				emit(parseInline(text[i+1:end], base|STYLE_ITALIC))
+				i = end + 1
+				continue
+			}
+		case c == '[':
+			if closeText := strings.Index(text[i:], "]("); closeText > 0 {
+				start := i + closeText + 2
+				if closeURL := strings.IndexByte(text[start:], ')'); closeURL >= 0 {
+					label := text[i+1 : i+closeText]
+					url := text[start : start+closeURL]
+					link := parseInline(label, base|STYLE_UNDERLINE)
+					if url != "" && url != label {
+						link = append(link, Span{fmt.Sprintf(" <%s>", url), base | STYLE_DIM})
+					}
+					emit(link)
+					i = start + closeURL + 1
+					continue
+				}
+			}
+		case c == '<':
+			if end := strings.IndexByte(text[i:], '>'); end > 0 {
+				target := text[i+1 : i+end]
+				if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") || strings.HasPrefix(target, "mailto:") {
+					emit([]Span{{target, base | STYLE_UNDERLINE}})
+					i += end + 1
+					continue
+				}
+			}
+		}
+		plain.WriteByte(c)
+		i++
+	}
+	emit(nil)
+	return spans
+}
+
+// findClosingEmphasis finds the delimiter closing single-character emphasis
+// starting at from. Returns -1 if none.
+func findClosingEmphasis(text string, from int, delim byte) int {
+	if from >= len(text) || text[from] == ' ' {
+		return -1
+	}
+	for j := from + 1; j < len(text); j++ {
+		if text[j] != delim || text[j-1] == ' ' {
+			continue
+		}
+		if delim == '_' && j+1 < len(text) && isWordByte(text[j+1]) {
+			continue
+		}
+		return j
+	}
+	return -1
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || (b >= '0' && b <= '9') || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || b >= 0x80
+}
+
+// wrapSpans lays spans out over as many lines as needed to fit width, breaking
+// between words. The first line starts with firstPrefix & the rest with
+// restPrefix.
+func wrapSpans(spans []Span, width int, firstPrefix []Span, restPrefix []Span) []StyledLine {
+	spansLen := func(ss []Span) int {
+		n := 0
+		for _, s := range ss {
+			n += StringWidth(s.Text)
+		}
+		return n
+	}
+
+	lines := []StyledLine{}
+	cur := append([]Span{}, firstPrefix...)
+	curlen := spansLen(firstPrefix)
+	avail := width - curlen
+	if avail <= 0 {
+		// Prefix doesn't fit at all; drop it
+		cur, curlen, avail = []Span{}, 0, width
+	}
+	linestart := true
+	newline := func() {
+		// Don't leave the space between words at the end of the line
+		if n := len(cur); !linestart && cur[n-1].Text == " " {
+			cur = cur[:n-1]
+		}
+		lines = append(lines, StyledLine{Spans: cur})
+		cur = append([]Span{}, restPrefix...)
+		curlen = spansLen(restPrefix)
+		if width-curlen <= 0 {
+			cur, curlen = []Span{}, 0
+		}
+		avail = width - curlen
+		linestart = true
+	}
+
+	for _, span := range spans {
+		for _, token := range splitWords(span.Text) {
+			if token == " " {
+				if !linestart && avail > 0 {
+					cur, curlen, avail = append(cur, Span{" ", span.Style}), curlen+1, avail-1
+				}
+				continue
+			}
+			tokenw := StringWidth(token)
+			if tokenw > avail && !linestart {
+				newline()
+			}
+			for tokenw > avail {
+				head, rest := wrapWidth(token, avail)
+				cur = append(cur, Span{head, span.Style})
+				token, tokenw = rest, StringWidth(rest)
+				newline()
+			}
+			cur, curlen, avail = append(cur, Span{token, span.Style}), curlen+tokenw, avail-tokenw
+			linestart = false
+		}
+	}
+	if !linestart || len(lines) == 0 {
+		lines = append(lines, StyledLine{Spans: cur})
+	}
+	return lines
+}
+
+// splitWords splits text into words & single spaces, collapsing runs of
+// spaces.
+func splitWords(text string) []string {
+	tokens := []string{}
+	for i, word := range strings.Split(text, " ") {
+		if i > 0 && (len(tokens) == 0 || tokens[len(tokens)-1] != " ") {
+			tokens = append(tokens, " ")
+		}
+		if word != "" {
+			tokens = append(tokens, word)
+		}
+	}
+	return tokens
+}
+
+func setTextStyle(style TextStyle) {
+	if style&STYLE_CODE != 0 {
+		SetPalette(CodePalette)
+	}
+	if style&STYLE_BOLD != 0 {
+		fmt.Print("\033[1m")
+	}
+	if style&STYLE_DIM != 0 {
+		fmt.Print("\033[2m")
+	}
+	if style&STYLE_ITALIC != 0 {
+		fmt.Print("\033[3m")
+	}
+	if style&STYLE_UNDERLINE != 0 {
+		fmt.Print("\033[4m")
+	}
+}
+
+func resetTextStyle() {
+	fmt.Print("\033[22;23;24m")
+	SetPalette(DefaultPalette)
+}
+
+// DrawStyledLine draws line starting at (row, col), clipped to width. Control
+// characters are shown rather than sent to the terminal.
+func DrawStyledLine(row, col, width int, line StyledLine) {
+	Move(row, col)
+	used := 0
+	for _, span := range line.Spans {
+		text, _ := splitWidth(SanitizeText(span.Text), width-used)
+		setTextStyle(span.Style)
+		fmt.Print(text)
+		resetTextStyle()
+		used += StringWidth(text)
+		if used >= width {
+			break
+		}
+	}
+	if line.CodeBlock && used < width {
+		setTextStyle(STYLE_CODE)
+		fmt.Print(strings.Repeat(" ", width-used))
+		resetTextStyle()
+	}
+}
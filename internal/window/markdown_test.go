@@ -0,0 +1,150 @@
+package window
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// merged joins neighbouring spans with the same style, since the renderer
+// splits text into words & spaces.
+func merged(lines []StyledLine) []StyledLine {
+	out := []StyledLine{}
+	for _, line := range lines {
+		var spans []Span
+		for _, span := range line.Spans {
+			if n := len(spans); n > 0 && spans[n-1].Style == span.Style {
+				spans[n-1].Text += span.Text
+				continue
+			}
+			spans = append(spans, span)
+		}
+		out = append(out, StyledLine{spans, line.CodeBlock})
+	}
+	return out
+}
+
+func plain(text string) StyledLine {
+	return StyledLine{Spans: []Span{{text, 0}}}
+}
+
+func code(text string) StyledLine {
+	return StyledLine{[]Span{{text, STYLE_CODE}}, true}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		width int
+		want  []StyledLine
+	}{
+		{"paragraph", "one\ntwo\n\nthree", 20, []StyledLine{plain("one two"), {}, plain("three")}},
+		{"heading", "# Title", 20, []StyledLine{{Spans: []Span{{"Title", STYLE_BOLD | STYLE_UNDERLINE}}}}},
+		{"second-level heading", "## Title ##", 20, []StyledLine{{Spans: []Span{{"Title", STYLE_BOLD | STYLE_UNDERLINE}}}}},
+		{"third-level heading", "### Title", 20, []StyledLine{{Spans: []Span{{"Title", STYLE_BOLD}}}}},
+		{"not a heading", "#hashtag", 20, []StyledLine{plain("#hashtag")}},
+		{"bullet list", "- one\n* two", 20, []StyledLine{plain(MARKDOWN_BULLET + "one"), plain(MARKDOWN_BULLET + "two")}},
+		{"nested list", "- one\n  - two", 20, []StyledLine{plain(MARKDOWN_BULLET + "one"), plain("  " + MARKDOWN_BULLET + "two")}},
+		{"numbered list", "1. one\n2) two", 20, []StyledLine{plain("1. one"), plain("2) two")}},
+		{"wrapped list item", "- one two three", 9, []StyledLine{plain(MARKDOWN_BULLET + "one two"), plain("  three")}},
+		{"code block", "```go\nx := *y*\n\n```\nafter", 20, []StyledLine{code("x := *y*"), code(""), plain("after")}},
+		{"tilde code block", "~~~\n# not a heading\n~~~", 20, []StyledLine{code("# not a heading")}},
+		{"unclosed code block", "```\ncode", 20, []StyledLine{code("code")}},
+		{"wrapped code block", "```\nabcdefgh\n```", 5, []StyledLine{code("abcde"), code("fgh")}},
+		{"emphasis", "a *b* _c_ **d** __e__", 20, []StyledLine{{Spans: []Span{
+			{"a ", 0}, {"b", STYLE_ITALIC}, {" ", 0}, {"c", STYLE_ITALIC}, {" ", 0}, {"d", STYLE_BOLD}, {" ", 0}, {"e", STYLE_BOLD},
+		}}}},
+		{"emphasis in bold", "**a _b_**", 20, []StyledLine{{Spans: []Span{{"a ", STYLE_BOLD}, {"b", STYLE_BOLD | STYLE_ITALIC}}}}},
+		{"underscores in words", "snake_case_name", 20, []StyledLine{plain("snake_case_name")}},
+		{"unclosed emphasis", "2 * 3", 20, []StyledLine{plain("2 * 3")}},
+		{"inline code", "run `go *test*`", 20, []StyledLine{{Spans: []Span{{"run ", 0}, {"go *test*", STYLE_CODE}}}}},
+		{"escaped", `\*not\*`, 20, []StyledLine{plain("*not*")}},
+		{"link", "[docs](https://x.io)", 30, []StyledLine{{Spans: []Span{{"docs", STYLE_UNDERLINE}, {" <https://x.io>", STYLE_DIM}}}}},
+		{"autolink", "<https://x.io>", 30, []StyledLine{{Spans: []Span{{"https://x.io", STYLE_UNDERLINE}}}}},
+		{"quote", "> said", 20, []StyledLine{{Spans: []Span{{MARKDOWN_QUOTE_BAR, STYLE_DIM}, {"said", STYLE_ITALIC}}}}},
+		{"rule", "---", 4, []StyledLine{{Spans: []Span{{"────", STYLE_DIM}}}}},
+		{"wrapping", "the quick brown fox", 10, []StyledLine{plain("the quick"), plain("brown fox")}},
+		{"long word", "abcdefghij", 4, []StyledLine{plain("abcd"), plain("efgh"), plain("ij")}},
+		{"wide characters", "日本語 日本語", 7, []StyledLine{plain("日本語"), plain("日本語")}},
+		{"tabs & carriage returns", "```\r\na\tb\r\n```", 20, []StyledLine{code("a" + strings.Repeat(" ", MARKDOWN_TAB_WIDTH) + "b")}},
+		{"wrapped link", "see [the docs](https://x.io)", 8, []StyledLine{
+			{Spans: []Span{{"see ", 0}, {"the", STYLE_UNDERLINE}}},
+			{Spans: []Span{{"docs", STYLE_UNDERLINE}}},
+			{Spans: []Span{{"<https:/", STYLE_DIM}}},
+			{Spans: []Span{{"/x.io>", STYLE_DIM}}},
+		}},
+		{"control characters", "a\x1b]52;c;eA==\x07b\u009b", 30, []StyledLine{plain("a^[]52;c;eA==^Gb�")}},
+		{"control characters in code", "```\n\x1b[2J\n```", 20, []StyledLine{code("^[[2J")}},
+		{"no width", "text", 0, []StyledLine{}},
+	}
+	for _, test := range tests {
+		got := merged(RenderMarkdown(test.text, test.width))
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: RenderMarkdown(%q, %d) = %+v, want %+v", test.name, test.text, test.width, got, test.want)
+		}
+	}
+}
+
+func TestRenderMarkdownWidth(t *testing.T) {
+	text := "# A heading that is long\n\nSome **bold** text & `code`, plus a [link](https://example.com/long/path).\n\n" +
+		"- a list item that wraps\n  1. nested item\n\n日本語テキスト\n\n> a quote that wraps too\n\n```\nfunc main() { fmt.Println(\"hi\") }\n```\n"
+	// From 2, since a wide character can't fit in 1 column
+	for width := 2; width <= 30; width++ {
+		for i, line := range RenderMarkdown(text, width) {
+			linew := 0
+			for _, span := range line.Spans {
+				linew += StringWidth(span.Text)
+			}
+			if linew > width {
+				t.Errorf("width %d: line %d is %d columns wide: %+v", width, i, linew, line.Spans)
+			}
+		}
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	tests := []struct {
+		text  string
+		width int
+		want  []string
+	}{
+		{"one two three", 7, []string{"one two", "three"}},
+		{"abcdefgh", 3, []string{"abc", "def", "gh"}},
+		{"a\n\nb\n", 5, []string{"a", "", "b"}},
+		{"a\tb\r", 20, []string{"a" + strings.Repeat(" ", PREVIEW_TAB_WIDTH) + "b"}},
+		{"\x1b[31mred", 20, []string{"^[[31mred"}},
+		{"text", 0, []string{}},
+	}
+	for _, test := range tests {
+		if got := WrapText(test.text, test.width); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("WrapText(%q, %d) = %q, want %q", test.text, test.width, got, test.want)
+		}
+	}
+}
+
+func TestSanitizeText(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"plain text", "plain text"},
+		{"日本語 " + family, "日本語 " + family},
+		{"keeps\nnewlines\tand tabs", "keeps\nnewlines\tand tabs"},
+		{"a\nb\x1b\tc", "a\nb^[\tc"},
+		{"\x1b[2J", "^[[2J"},
+		{"\x00\x01\x1f\x7f", "^@^A^_^?"},
+		{"\x1b]0;title\x07", "^[]0;title^G"},
+		{"C1 \u009b2J \u0085", "C1 �2J �"},
+		{"bad \xff\xfe UTF-8", "bad �� UTF-8"},
+	}
+	for _, test := range tests {
+		got := SanitizeText(test.s)
+		if got != test.want {
+			t.Errorf("SanitizeText(%q) = %q, want %q", test.s, got, test.want)
+		}
+		if strings.ContainsAny(got, "\x1b\x07\u009b") {
+			t.Errorf("SanitizeText(%q) = %q, still has controls", test.s, got)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package window
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
@@ -9,6 +10,7 @@ import (
 
 type Modal struct {
 	Window
+	parent    *Window
 	Title     *TextLabel
 	Fields    []*ModalField
 	OK        *Button
@@ -18,6 +20,7 @@ type Modal struct {
 
 type OptionModal struct {
 	Window
+	parent    *Window
 	Title     *TextLabel
 	Options   []*Button
 	Selection *ModalOptionSelection
@@ -70,16 +73,42 @@ func NewModalOptionSelection(numOptions int) *ModalOptionSelection {
 // - Extract Modal into an interface
 // - Smarter tiling - max 3 per row but use squares if possible (e.g. 2x2)
 func NewOptionModal(window *Window, title string, options []string) *OptionModal {
-	// Find max width of buttons
-	rowmin, rowmax, colmin, colmax := window.GetTextBounds()
-
 	if len(options) == 0 {
 		options = []string{"OK"}
 	}
 
+	buttons := make([]*Button, len(options))
+	for i, o := range options {
+		buttons[i] = NewButton(0, 0, 0, 0, o)
+	}
+
+	selection := NewModalOptionSelection(len(options))
+	modal := &OptionModal{
+		Window{0, 0, 0, 0, true, []int{}},
+		window,
+		NewTextLabel(0, 0, title),
+		buttons,
+		selection,
+	}
+	modal.Layout()
+	return modal
+}
+
+// Layout positions the modal & its buttons relative to the current bounds of
+// the parent window. Call after the parent has been resized.
+func (modal *OptionModal) Layout() {
+	// Find max width of buttons
+	rowmin, rowmax, colmin, colmax := modal.parent.GetTextBounds()
+
+	title := modal.Title.Value
+	options := make([]string, len(modal.Options))
+	for i, b := range modal.Options {
+		options[i] = b.Text
+	}
+
 	buttonxbuf, buttonybuf := 5, 2
 	buttonh := 3
-	buttonw := util.Max(8, len(util.MaxBy(options, func(f string) int { return len(f) }).Value)).Value + 2
+	buttonw := util.Max(8, StringWidth(util.MaxBy(options, func(f string) int { return StringWidth(f) }).Value)).Value + 2
 
 	// Tile buttons in rows of 3
 	titleh := 1
@@ -90,7 +119,7 @@ func NewOptionModal(window *Window, title string, options []string) *OptionModal
 	buttonareaw := numcols*buttonw + (numcols-1)*buttonxbuf
 	buttonareah := numrows*buttonh + (numrows-1)*buttonybuf
 	modalh := titlebuftop + titleh + buttonybuf + buttonareah + buttonybuf
-	modalw := util.Max(len(title)+titlebufleft+titlebufright, buttonareaw+2*buttonxbuf).Value
+	modalw := util.Max(StringWidth(title)+titlebufleft+titlebufright, buttonareaw+2*buttonxbuf).Value
 
 	excessw := modalw - buttonareaw
 	buttonareabuf := excessw / 2
@@ -99,25 +128,17 @@ func NewOptionModal(window *Window, title string, options []string) *OptionModal
 	modaly := (rowmax - rowmin - modalh) / 2
 
 	titlex, titley := modalx+titlebufleft, modaly+titlebuftop
-	titleLabel := NewTextLabel(titlex, titley, title)
+	modal.Title.X, modal.Title.Y = titlex, titley
 
 	firstbuttonx := modalx + buttonareabuf
 	firstbuttony := titley + buttonybuf
-	buttons := make([]*Button, len(options))
-	for i, o := range options {
-		buttonx := firstbuttonx + ((buttonw + buttonxbuf) * (i % buttonsperrow))
-		buttony := firstbuttony + ((buttonh + buttonybuf) * (i / buttonsperrow))
-		buttons[i] = NewButton(buttonx, buttony, buttonw, buttonh, o)
+	for i, b := range modal.Options {
+		b.X = firstbuttonx + ((buttonw + buttonxbuf) * (i % buttonsperrow))
+		b.Y = firstbuttony + ((buttonh + buttonybuf) * (i / buttonsperrow))
+		b.Width, b.Height = buttonw, buttonh
 	}
 
-	selection := NewModalOptionSelection(len(options))
-	modal := &OptionModal{
-		Window{modalx, modaly, modalw, modalh, true, []int{}},
-		titleLabel,
-		buttons,
-		selection,
-	}
-	return modal
+	modal.X, modal.Y, modal.Width, modal.Height = modalx, modaly, modalw, modalh
 }
 
 func (modal *OptionModal) Draw() {
@@ -169,91 +190,129 @@ func (modal *OptionModal) ResetSelection() {
 	modal.UpdateFromSelection()
 }
 
-func IsAscii(inp uint32) bool {
-	return inp <= 127
+// SelectAt selects the option at the screen position, if any. Returns true if
+// there was one.
+func (modal *OptionModal) SelectAt(row, col int) bool {
+	for i, b := range modal.Options {
+		if b.Contains(row, col) {
+			modal.Selection.CurrentOption = i
+			modal.UpdateFromSelection()
+			return true
+		}
+	}
+	return false
 }
 
 func OptionModalEventLoop(main *MainWindow, modal *OptionModal) bool {
-	var input uint32 = 0
 	for {
 		// TODO: Others to handle:
 		// - CTRL+Backspace
 		// - Delete
 		// - Terminal movement (CTRL+W, etc.)
 		// - Scrolling
-		// - Non-ASCII characters (Unicode alphanumeric/spaces?)
-		input = ReadInput()
-		switch input {
-		case 0x03, 0x1b: // CTRL+C/ESC
+		submit := false
+		switch ReadKey() {
+		case Key{Code: KEY_RESIZE}:
+			main.ResizeToTerminal()
+			main.Draw()
+			modal.Layout()
+			modal.UpdateFromSelection()
+		case Ctrl('c'), Key{Code: KEY_ESC}:
 			return false
-		case 0x0d: // ENTER
-			err := modal.Validate()
-			if err == nil {
-				err = modal.Save()
-			}
-			if err == nil {
-				return true
-			}
-			modal.ShowErrorBox(err)
-			modal.Draw()
-			// TODO: reset input to invalid field?
-			modal.ResetSelection()
-		case 0x09: // TAB
+		case Key{Code: KEY_ENTER}:
+			submit = true
+		case Key{Code: KEY_CLICK}, Key{Code: KEY_DOUBLE_CLICK}:
+			// Clicking an option chooses it
+			submit = modal.SelectAt(MousePosition())
+		case Key{Code: KEY_TAB}:
 			modal.Selection.SelectNext()
 			modal.UpdateFromSelection()
-		case 0x5a5b1b: // SHIFT+TAB
+		case Key{KEY_TAB, 0, MOD_SHIFT}:
 			modal.Selection.SelectPrev()
 			modal.UpdateFromSelection()
 		}
+		if !submit {
+			continue
+		}
+
+		err := modal.Validate()
+		if err == nil {
+			err = modal.Save()
+		}
+		if err == nil {
+			return true
+		}
+		modal.showErrorBox(err, func() {
+			main.ResizeToTerminal()
+			main.Draw()
+			modal.Layout()
+			modal.Draw()
+		})
+		modal.Draw()
+		// TODO: reset input to invalid field?
+		modal.ResetSelection()
 	}
 }
 
 func NewInputModal(window *Window, title string, okLabel string, cancelLabel string, fields map[string]string) *Modal {
-	rowmin, rowmax, colmin, colmax := window.GetTextBounds()
+	modalFields := make([]*ModalField, 0, len(fields))
+	for k, v := range fields {
+		modalFields = append(modalFields, &ModalField{
+			NewTextLabel(0, 0, k),
+			NewTextInput(0, 0, 70, v),
+		})
+	}
+
+	buttonw, buttonh := 20, 3
+	okButton := NewButton(0, 0, buttonw, buttonh, okLabel)
+	cancelButton := NewButton(0, 0, buttonw, buttonh, cancelLabel)
+	selection := NewModalInputSelection(len(modalFields))
+	modal := &Modal{
+		Window{0, 0, 0, 0, true, []int{}},
+		window,
+		NewTextLabel(0, 0, title),
+		modalFields,
+		okButton,
+		cancelButton,
+		selection,
+	}
+	modal.Layout()
+	return modal
+}
+
+// Layout positions the modal, its fields & its buttons relative to the
+// current bounds of the parent window. Call after the parent has been resized.
+func (modal *Modal) Layout() {
+	rowmin, rowmax, colmin, colmax := modal.parent.GetTextBounds()
 	minvaluew := 80
 	var maxdescw int
-	if len(fields) > 0 {
-		maxdescw = len(util.MaxBy(util.Keys[string, string](fields), func(f string) int { return len(f) }).Value)
+	if len(modal.Fields) > 0 {
+		maxdescw = StringWidth(util.MaxBy(util.Keys[string, string](modal.GetFieldValues()), func(f string) int { return StringWidth(f) }).Value)
 	} else {
-		maxdescw = len(title)
+		maxdescw = StringWidth(modal.Title.Value)
 	}
 
 	fieldh := 6
-	modalw, modalh := util.Max(minvaluew, maxdescw).Value, (len(fields)+1)*fieldh+3
+	modalw, modalh := util.Max(minvaluew, maxdescw).Value, (len(modal.Fields)+1)*fieldh+3
 	modalx := (colmax - colmin - modalw) / 2
 	modaly := (rowmax - rowmin - modalh) / 2
 
 	titlex, titley := modalx+2, modaly+2
-	titleLabel := NewTextLabel(titlex, titley, title)
+	modal.Title.X, modal.Title.Y = titlex, titley
 
 	fieldy, fieldx := titley+2, titlex+1
-	modalFields := make([]*ModalField, len(fields))
-	i := 0
-	for k, v := range fields {
-		modalFields[i] = &ModalField{
-			NewTextLabel(fieldx, fieldy, k),
-			NewTextInput(fieldx, fieldy+1, 70, v),
-		}
+	for _, mf := range modal.Fields {
+		mf.Label.X, mf.Label.Y = fieldx, fieldy
+		mf.Input.X, mf.Input.Y = fieldx, fieldy+1
 		fieldy += fieldh
-		i += 1
 	}
 
 	buttonbuf := 5
-	buttony, buttonw, buttonh := fieldy, 20, 3
-	okx := modalx + buttonbuf
-	cancelx := modalx + modalw - buttonw - buttonbuf
-	okButton := NewButton(okx, buttony, buttonw, buttonh, okLabel)
-	cancelButton := NewButton(cancelx, buttony, buttonw, buttonh, cancelLabel)
-	selection := NewModalInputSelection(len(modalFields))
-	modal := &Modal{
-		Window{modalx, modaly, modalw, modalh, true, []int{}},
-		titleLabel,
-		modalFields,
-		okButton,
-		cancelButton,
-		selection,
-	}
-	return modal
+	buttony := fieldy
+	modal.OK.X, modal.OK.Y = modalx+buttonbuf, buttony
+	modal.Cancel.X, modal.Cancel.Y = modalx+modalw-modal.Cancel.Width-buttonbuf, buttony
+
+	modal.X, modal.Y, modal.Width, modal.Height = modalx, modaly, modalw, modalh
 }
 
 func (modal *Modal) Draw() {
@@ -272,31 +331,58 @@ func (modal *Modal) SelectField(idx int) {
 	fields := modal.Fields
 	if idx >= 0 && idx <= len(fields)-1 {
 		f := fields[idx]
-		y, _, x, _ := f.Input.GetTextBounds()
-		valLen := len(f.Input.Value)
-		Move(y, x+valLen)
+		y, _, _, _ := f.Input.GetTextBounds()
+		Move(y, f.Input.CursorColumn())
 	} else {
 		panic("ahhh")
 	}
 }
 
 // TODO: Optional title
-func (window *Window) ShowErrorBox(err error) {
-	// TODO: Line splitting/some control over display
-	SetPalette(ErrorPalette)
-	defer SetPalette(DefaultPalette)
+func (window *MainWindow) ShowErrorBox(err error) {
+	window.showErrorBox(err, func() {
+		window.ResizeToTerminal()
+		window.Draw()
+	})
+}
 
+// showErrorBox shows err over the window until a key is pressed. On a resize,
+// relayout is called to resize & redraw whatever is underneath before the box
+// is laid out again over the window's new bounds.
+func (window *Window) showErrorBox(err error, relayout func()) {
+	// TODO: Line splitting/some control over display
 	HideCursor()
 	defer ShowCursor()
 
-	rowmin, rowmax, colmin, colmax := window.GetTextBounds()
-
 	errString := fmt.Sprintf("%s", err)
+	draw := func() {
+		rowmin, rowmax, colmin, colmax := window.GetTextBounds()
+		x, y, w, h := colmin, rowmin, colmax-colmin-3, rowmax-rowmin-3
+		SetPalette(ErrorPalette)
+		NewSizedBorderedTextLabel(x, y, w, h, errString, []int{}).Draw()
+		SetPalette(DefaultPalette)
+	}
+	draw()
+	// Keep the box up across resizes & background refreshes; whoever asked
+	// for it redraws afterwards.
+	for key := ReadKey(); key.Code == KEY_RESIZE || key.Code == KEY_REFRESH; key = ReadKey() {
+		if key.Code == KEY_RESIZE {
+			relayout()
+		}
+		draw()
+	}
+}
 
-	x, y, w, h := colmin, rowmin, colmax-colmin-3, rowmax-rowmin-3
-	label := NewSizedBorderedTextLabel(x, y, w, h, errString, []int{})
+// DrawStatus shows a message in the middle of the window without waiting for
+// input, e.g. while a long-running operation is in progress. The next Draw()
+// clears it.
+func (window *MainWindow) DrawStatus(msg string) {
+	rowmin, rowmax, colmin, colmax := window.GetTextBounds()
+	labelw := StringWidth(msg) + 4
+	x := colmin + (colmax-colmin-labelw)/2
+	y := rowmin + (rowmax-rowmin-3)/2
+	label := NewSizedBorderedTextLabel(x, y, labelw, 3, " "+msg, []int{})
 	label.Draw()
-	ReadInput()
 }
 
 // TODO: Optional title
@@ -308,6 +394,63 @@ func (window *MainWindow) ShowInfoBox(msg string) {
 	window.RequestOptionSelection(msg, []string{})
 }
 
+// RunWithMessage shows lines in a box while work runs in the background,
+// e.g. waiting for the user to log in elsewhere. ESC/CTRL+C/q cancels work's
+// context. Returns work's error.
+func (window *MainWindow) RunWithMessage(lines []string, work func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- work(ctx)
+		PostRefresh()
+	}()
+
+	lines = append(append([]string{}, lines...), "", "(ESC to cancel)")
+	draw := func() {
+		rowmin, rowmax, colmin, colmax := window.GetTextBounds()
+		// Long lines (e.g. URLs) are wrapped rather than cut off
+		maxw := colmax - colmin + 1
+		shown := []string{}
+		for _, l := range lines {
+			for _, wrapped := range WrapText(l, maxw-3) {
+				shown = append(shown, " "+wrapped)
+			}
+		}
+		labelw := 0
+		for _, l := range shown {
+			labelw = util.Max(labelw, StringWidth(l)+3).Value
+		}
+		labelw = util.Min(labelw, maxw).Value
+		labelh := util.Min(len(shown)+2, rowmax-rowmin+1).Value
+		x := colmin + util.Max((colmax-colmin-labelw)/2, 0).Value
+		y := rowmin + util.Max((rowmax-rowmin-labelh)/2, 0).Value
+		NewSizedBorderedMultilineTextLabel(x, y, labelw, labelh, shown[:labelh-2], []int{}).Draw()
+	}
+
+	HideCursor()
+	draw()
+	for {
+		key := ReadKey()
+		select {
+		case err := <-done:
+			return err
+		default:
+		}
+
+		switch key {
+		case Key{Code: KEY_RESIZE}:
+			window.ResizeToTerminal()
+			window.Draw()
+		case Key{Code: KEY_ESC}, Ctrl('c'), Char('q'):
+			cancel()
+			return <-done
+		}
+		draw()
+	}
+}
+
 func (m *Modal) GetFieldValues() map[string]string {
 	vals := map[string]string{}
 	for _, f := range m.Fields {
@@ -410,56 +553,94 @@ func (modal *Modal) ResetSelection() {
 	modal.UpdateFromSelection()
 }
 
+// SelectAt selects the field or button at the screen position, if any.
+// Returns true if it's a button, which clicking presses.
+func (modal *Modal) SelectAt(row, col int) bool {
+	s := modal.Selection
+	for i, f := range modal.Fields {
+		if f.Input.Contains(row, col) {
+			s.CurrentField, s.OKSelected, s.CancelSelected = i, false, false
+			modal.UpdateFromSelection()
+			return false
+		}
+	}
+	if modal.OK.Contains(row, col) {
+		s.CurrentField, s.OKSelected, s.CancelSelected = -1, true, false
+	} else if modal.Cancel.Contains(row, col) {
+		s.CurrentField, s.OKSelected, s.CancelSelected = -1, false, true
+	} else {
+		return false
+	}
+	modal.UpdateFromSelection()
+	return true
+}
+
 func ModalEventLoop(main *MainWindow, modal *Modal) bool {
-	var input uint32 = 0
 	for {
 		// TODO: Others to handle:
 		// - CTRL+Backspace
 		// - Delete
 		// - Terminal movement (CTRL+W, etc.)
 		// - Scrolling
-		// - Non-ASCII characters (Unicode alphanumeric/spaces?)
-		input = ReadInput()
-		switch input {
-		case 0x03, 0x1b: // CTRL+C/ESC
+		key := ReadKey()
+		submit := false
+		switch key {
+		case Key{Code: KEY_RESIZE}:
+			main.ResizeToTerminal()
+			main.Draw()
+			modal.Layout()
+			modal.UpdateFromSelection()
+		case Ctrl('c'), Key{Code: KEY_ESC}:
 			return false
-		case 0x0d: // ENTER
-			if modal.OK.IsSelected || modal.GetCurrentField() != nil {
-				err := modal.Validate()
-				if err == nil {
-					err = modal.Save()
-				}
-				if err == nil {
-					return true
-				}
-				modal.ShowErrorBox(err)
-				modal.Draw()
-				// TODO: reset input to invalid field?
-				modal.UpdateFromSelection()
-			} else if modal.Cancel.IsSelected {
-				return false
-			}
-		case 0x09: // TAB
+		case Key{Code: KEY_ENTER}:
+			submit = true
+		case Key{Code: KEY_CLICK}, Key{Code: KEY_DOUBLE_CLICK}:
+			submit = modal.SelectAt(MousePosition())
+		case Key{Code: KEY_TAB}:
 			modal.Selection.SelectNext()
 			modal.UpdateFromSelection()
-		case 0x5a5b1b: // SHIFT+TAB
+		case Key{KEY_TAB, 0, MOD_SHIFT}:
 			modal.Selection.SelectPrev()
 			modal.UpdateFromSelection()
-		case 0x7f: // Backspace
+		case Key{Code: KEY_BACKSPACE}:
 			field := modal.GetCurrentField()
 			if field != nil && len(field.Input.Value) > 0 {
-				field.Input.Value = field.Input.Value[:len(field.Input.Value)-1]
+				field.Input.Value = dropLastSymbol(field.Input.Value)
 				field.Input.Draw()
 				modal.UpdateFromSelection()
 			}
 		default:
 			field := modal.GetCurrentField()
-			if field != nil && IsAscii(input) {
-				field.Input.Value = fmt.Sprintf("%s%c", field.Input.Value, input)
+			if field != nil && key.Printable() {
+				field.Input.Value += string(key.Rune)
 				field.Input.Draw()
 				modal.UpdateFromSelection()
 			}
 		}
+		if !submit {
+			continue
+		}
+
+		if modal.OK.IsSelected || modal.GetCurrentField() != nil {
+			err := modal.Validate()
+			if err == nil {
+				err = modal.Save()
+			}
+			if err == nil {
+				return true
+			}
+			modal.showErrorBox(err, func() {
+				main.ResizeToTerminal()
+				main.Draw()
+				modal.Layout()
+				modal.Draw()
+			})
+			modal.Draw()
+			// TODO: reset input to invalid field?
+			modal.UpdateFromSelection()
+		} else if modal.Cancel.IsSelected {
+			return false
+		}
 	}
 }
 
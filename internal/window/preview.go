@@ -0,0 +1,258 @@
+package window
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mrshanahan/notes-api/pkg/notes"
+	"mrshanahan.com/notes-term/internal/util"
+)
+
+const (
+	PREVIEW_DEBOUNCE    = 150 * time.Millisecond
+	PREVIEW_RETRY_DELAY = 3 * time.Second // Before fetching again after a failed fetch
+	PREVIEW_MIN_WIDTH   = 80              // Terminal width below which the preview is hidden
+	PREVIEW_TAB_WIDTH   = 4
+)
+
+// ContentSource provides note contents to the preview pane. Lookup is called
+// on every draw, so must not block (e.g. on disk or the network); Get may.
+type ContentSource interface {
+	Lookup(note *notes.Note) ([]byte, bool)
+	Get(note *notes.Note) ([]byte, error)
+}
+
+// PreviewPane shows the (read-only) content of the selected note. Content is
+// fetched in the background after the selection has settled, and the pane
+// asks for a redraw via PostRefresh once it arrives.
+type PreviewPane struct {
+	Window
+	ScrollOffset int
+	// Render content as Markdown rather than showing it raw
+	Markdown bool
+
+	source  ContentSource
+	mu      sync.Mutex
+	note    *notes.Note
+	content []byte
+	loaded  bool
+	err     error
+	loading bool
+	timer   *time.Timer
+	// Bumped by SetSource, so that fetches from the old source are dropped
+	generation int
+
+	lines         []StyledLine
+	linesWidth    int
+	linesMarkdown bool
+}
+
+func NewPreviewPane(source ContentSource) *PreviewPane {
+	// Bounds are set by the owning window's layout
+	return &PreviewPane{Window: Window{0, 0, 0, 0, false, []int{}}, Markdown: true, source: source}
+}
+
+// SetBounds places the pane's text area at exactly the given rows & columns.
+func (pane *PreviewPane) SetBounds(rowmin, rowmax, colmin, colmax int) {
+	// Without borders, GetTextBounds() spans X..X+Width & Y..Y+Height
+	pane.X, pane.Y = colmin, rowmin
+	pane.Width, pane.Height = colmax-colmin, rowmax-rowmin
+}
+
+// SetSource changes where content comes from, dropping anything shown or
+// pending from the old source.
+func (pane *PreviewPane) SetSource(source ContentSource) {
+	pane.mu.Lock()
+	defer pane.mu.Unlock()
+
+	pane.stopTimer()
+	pane.source = source
+	pane.generation++
+	pane.note, pane.content, pane.loaded, pane.err, pane.loading = nil, nil, false, nil, false
+	pane.lines = nil
+	pane.ScrollOffset = 0
+}
+
+// Update points the pane at the given note. If its content isn't cached a
+// fetch is scheduled; moving to another note before it fires cancels it.
+func (pane *PreviewPane) Update(note *notes.Note) {
+	pane.mu.Lock()
+	defer pane.mu.Unlock()
+
+	if note == nil {
+		pane.stopTimer()
+		pane.note, pane.content, pane.loaded, pane.err, pane.loading = nil, nil, false, nil, false
+		pane.lines = nil
+		return
+	}
+	if pane.note == nil || pane.note.ID != note.ID {
+		pane.stopTimer()
+		pane.note, pane.content, pane.loaded, pane.err, pane.loading = note, nil, false, nil, false
+		pane.lines = nil
+		pane.ScrollOffset = 0
+	}
+
+	if content, ok := pane.source.Lookup(note); ok {
+		if !pane.loaded || string(content) != string(pane.content) {
+			pane.content, pane.loaded, pane.lines = content, true, nil
+		}
+		pane.loading = false
+		return
+	}
+	if pane.loading {
+		return
+	}
+
+	// The error stays on screen until the next fetch has come back
+	delay := PREVIEW_DEBOUNCE
+	if pane.err != nil {
+		delay = PREVIEW_RETRY_DELAY
+	}
+	pane.loading = true
+	source, generation := pane.source, pane.generation
+	pane.timer = time.AfterFunc(delay, func() {
+		content, err := source.Get(note)
+
+		pane.mu.Lock()
+		if pane.generation == generation && pane.note != nil && pane.note.ID == note.ID {
+			pane.content, pane.loaded, pane.err, pane.loading = content, err == nil, err, false
+			pane.lines = nil
+		}
+		pane.mu.Unlock()
+		PostRefresh()
+	})
+}
+
+// Reload drops the content shown for the current note, including any error,
+// so that it's fetched again on the next Update.
+func (pane *PreviewPane) Reload() {
+	pane.mu.Lock()
+	defer pane.mu.Unlock()
+
+	pane.stopTimer()
+	pane.content, pane.loaded, pane.err, pane.loading = nil, false, nil, false
+	pane.lines = nil
+}
+
+func (pane *PreviewPane) stopTimer() {
+	if pane.timer != nil {
+		pane.timer.Stop()
+		pane.timer = nil
+	}
+}
+
+// PageSize returns the number of content lines visible at once.
+func (pane *PreviewPane) PageSize() int {
+	rowmin, rowmax, _, _ := pane.GetTextBounds()
+	// First row is the note title
+	return util.Max(rowmax-rowmin, 1).Value
+}
+
+// Scroll moves the view by delta lines, staying within the content.
+func (pane *PreviewPane) Scroll(delta int) {
+	pane.mu.Lock()
+	defer pane.mu.Unlock()
+
+	lines := pane.wrappedLines()
+	maxoffset := util.Max(len(lines)-pane.PageSize(), 0).Value
+	offset := util.Min(pane.ScrollOffset+delta, maxoffset).Value
+	pane.ScrollOffset = util.Max(offset, 0).Value
+}
+
+// ToggleMarkdown switches between rendered & raw views of the content.
+func (pane *PreviewPane) ToggleMarkdown() {
+	pane.mu.Lock()
+	defer pane.mu.Unlock()
+	pane.Markdown = !pane.Markdown
+	pane.ScrollOffset = 0
+}
+
+// wrappedLines returns the content rendered to the pane's width, recomputing
+// only when the content, width or view has changed. Caller must hold pane.mu.
+func (pane *PreviewPane) wrappedLines() []StyledLine {
+	_, _, colmin, colmax := pane.GetTextBounds()
+	width := colmax - colmin + 1
+	if pane.lines == nil || pane.linesWidth != width || pane.linesMarkdown != pane.Markdown {
+		if pane.Markdown {
+			pane.lines = RenderMarkdown(string(pane.content), width)
+		} else {
+			pane.lines = PlainLines(string(pane.content), width)
+		}
+		pane.linesWidth, pane.linesMarkdown = width, pane.Markdown
+	}
+	return pane.lines
+}
+
+func (pane *PreviewPane) Draw() {
+	pane.mu.Lock()
+	defer pane.mu.Unlock()
+
+	pane.DrawInterior()
+	rowmin, _, colmin, colmax := pane.GetTextBounds()
+	width := colmax - colmin + 1
+
+	if pane.note == nil {
+		return
+	}
+
+	Move(rowmin, colmin)
+	fmt.Printf("%s%s%s", MATCH_HIGHLIGHT_ON, Truncate(SanitizeText(pane.note.Title), width), MATCH_HIGHLIGHT_OFF)
+
+	var lines []StyledLine
+	if pane.err != nil {
+		lines = PlainLines(fmt.Sprintf("Could not load note: %s", pane.err), width)
+	} else if !pane.loaded {
+		lines = PlainLines("Loading...", width)
+	} else {
+		lines = pane.wrappedLines()
+		status := ""
+		if !pane.Markdown {
+			status = " [raw]"
+		}
+		if len(lines) > pane.PageSize() {
+			status = fmt.Sprintf("%s %d/%d", status, pane.ScrollOffset+1, len(lines))
+		}
+		if status != "" {
+			DrawString(rowmin, colmax-len(status)+1, status)
+		}
+	}
+
+	last := util.Min(pane.ScrollOffset+pane.PageSize(), len(lines)).Value
+	for i := util.Min(pane.ScrollOffset, last).Value; i < last; i++ {
+		DrawStyledLine(rowmin+1+i-pane.ScrollOffset, colmin, width, lines[i])
+	}
+}
+
+// WrapText splits text into lines of at most width columns, breaking at spaces
+// where possible. Tabs are expanded, carriage returns dropped & other control
+// characters replaced (see SanitizeText).
+func WrapText(text string, width int) []string {
+	if width <= 0 {
+		return []string{}
+	}
+
+	text = strings.ReplaceAll(text, "\r", "")
+	text = strings.ReplaceAll(text, "\t", strings.Repeat(" ", PREVIEW_TAB_WIDTH))
+	text = SanitizeText(text)
+	lines := []string{}
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		for StringWidth(line) > width {
+			head, rest := wrapWidth(line, width)
+			split := strings.LastIndex(head, " ")
+			if strings.HasPrefix(rest, " ") {
+				split = len(head)
+			}
+			if split <= 0 {
+				lines = append(lines, head)
+				line = rest
+			} else {
+				lines = append(lines, line[:split])
+				line = line[split+1:]
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
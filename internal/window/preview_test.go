@@ -0,0 +1,126 @@
+package window
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mrshanahan/notes-api/pkg/notes"
+)
+
+// flakySource fails the first fails fetches & succeeds after that.
+type flakySource struct {
+	mu      sync.Mutex
+	fails   int
+	fetches int
+}
+
+func (s *flakySource) Lookup(note *notes.Note) ([]byte, bool) {
+	return nil, false
+}
+
+func (s *flakySource) Get(note *notes.Note) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fetches++
+	if s.fetches <= s.fails {
+		return nil, errors.New("server unavailable")
+	}
+	return []byte("content"), nil
+}
+
+// waitForFetch waits for the pane's pending fetch to come back.
+func waitForFetch(t *testing.T, pane *PreviewPane) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		pane.mu.Lock()
+		loading := pane.loading
+		pane.mu.Unlock()
+		if !loading {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("fetch didn't finish")
+}
+
+func TestPreviewRetriesAfterError(t *testing.T) {
+	source := &flakySource{fails: 1}
+	pane := NewPreviewPane(source)
+	note := &notes.Note{ID: 1, Title: "note"}
+
+	pane.Update(note)
+	waitForFetch(t, pane)
+	if pane.err == nil {
+		t.Fatal("expected the first fetch to fail")
+	}
+
+	// Drawing again schedules another fetch, keeping the error until then
+	pane.Update(note)
+	pane.mu.Lock()
+	loading, err := pane.loading, pane.err
+	pane.mu.Unlock()
+	if !loading || err == nil {
+		t.Errorf("after a failed fetch: loading = %v, err = %v; want a retry pending & the error kept", loading, err)
+	}
+	pane.stopTimer()
+}
+
+func TestPreviewReload(t *testing.T) {
+	source := &flakySource{fails: 1}
+	pane := NewPreviewPane(source)
+	note := &notes.Note{ID: 1, Title: "note"}
+
+	pane.Update(note)
+	waitForFetch(t, pane)
+
+	pane.Reload()
+	if pane.err != nil || pane.loaded {
+		t.Errorf("after Reload: err = %v, loaded = %v; want both cleared", pane.err, pane.loaded)
+	}
+	pane.Update(note)
+	waitForFetch(t, pane)
+	if pane.err != nil || !pane.loaded || string(pane.content) != "content" {
+		t.Errorf("after reloading: err = %v, loaded = %v, content = %q", pane.err, pane.loaded, pane.content)
+	}
+	if source.fetches != 2 {
+		t.Errorf("fetched %d times, want 2", source.fetches)
+	}
+}
+
+// blockingSource holds every fetch until release is closed.
+type blockingSource struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingSource) Lookup(note *notes.Note) ([]byte, bool) {
+	return nil, false
+}
+
+func (s *blockingSource) Get(note *notes.Note) ([]byte, error) {
+	close(s.started)
+	<-s.release
+	return []byte("old content"), nil
+}
+
+func TestPreviewSetSourceDuringFetch(t *testing.T) {
+	old := &blockingSource{make(chan struct{}), make(chan struct{})}
+	pane := NewPreviewPane(old)
+	note := &notes.Note{ID: 1, Title: "note"}
+
+	pane.Update(note)
+	<-old.started
+	pane.SetSource(&flakySource{})
+	pane.Update(note)
+	close(old.release)
+	waitForFetch(t, pane)
+
+	pane.mu.Lock()
+	defer pane.mu.Unlock()
+	if string(pane.content) != "content" {
+		t.Errorf("content = %q, want the new source's", pane.content)
+	}
+}
@@ -0,0 +1,182 @@
+package window
+
+import (
+	"fmt"
+	"strings"
+
+	"mrshanahan.com/notes-term/internal/util"
+)
+
+// SearchResult is a single line of note content matching a search.
+type SearchResult struct {
+	Title string
+	Line  int
+	Text  string
+	Start int // Byte offset of the match within Text
+	End   int // Byte offset just past the match within Text
+}
+
+// ResultsPane is a scrollable list of search results drawn over the main
+// window.
+type ResultsPane struct {
+	Window
+	parent       *Window
+	Title        string
+	Results      []*SearchResult
+	Selection    int
+	ScrollOffset int
+}
+
+func NewResultsPane(window *Window, title string, results []*SearchResult) *ResultsPane {
+	pane := &ResultsPane{
+		Window:  Window{0, 0, 0, 0, true, []int{}},
+		parent:  window,
+		Title:   title,
+		Results: results,
+	}
+	pane.Layout()
+	return pane
+}
+
+// Layout sizes the pane to fill most of the parent window. Call after the
+// parent has been resized.
+func (pane *ResultsPane) Layout() {
+	rowmin, rowmax, colmin, colmax := pane.parent.GetTextBounds()
+	xbuf, ybuf := 4, 2
+	pane.X, pane.Y = colmin-1+xbuf, rowmin-1+ybuf
+	pane.Width = util.Max(colmax-colmin+1-2*xbuf, 10).Value
+	pane.Height = util.Max(rowmax-rowmin+1-2*ybuf, 5).Value
+	pane.scrollToSelection()
+}
+
+// PageSize returns the number of results visible at once.
+func (pane *ResultsPane) PageSize() int {
+	rowmin, rowmax, _, _ := pane.GetTextBounds()
+	// First row is the title, second is a spacer
+	return util.Max(rowmax-rowmin-1, 1).Value
+}
+
+func (pane *ResultsPane) SetSelection(idx int) {
+	idx = util.Min(idx, len(pane.Results)-1).Value
+	pane.Selection = util.Max(idx, 0).Value
+	pane.scrollToSelection()
+}
+
+func (pane *ResultsPane) scrollToSelection() {
+	pagesize := pane.PageSize()
+	if pane.Selection < pane.ScrollOffset {
+		pane.ScrollOffset = pane.Selection
+	} else if pane.Selection >= pane.ScrollOffset+pagesize {
+		pane.ScrollOffset = pane.Selection - pagesize + 1
+	}
+}
+
+func (pane *ResultsPane) Draw() {
+	pane.DrawBorders()
+	pane.DrawInterior()
+
+	rowmin, _, colmin, colmax := pane.GetTextBounds()
+	header := fmt.Sprintf("%s (%d/%d)", pane.Title, pane.Selection+1, len(pane.Results))
+	DrawString(rowmin, colmin, Truncate(header, colmax-colmin+1))
+
+	last := util.Min(pane.ScrollOffset+pane.PageSize(), len(pane.Results)).Value
+	for i := pane.ScrollOffset; i < last; i++ {
+		palette := DefaultPalette
+		if i == pane.Selection {
+			palette = HighlightPalette
+		}
+		pane.drawResultRow(rowmin+2+i-pane.ScrollOffset, pane.Results[i], palette)
+	}
+}
+
+func (pane *ResultsPane) drawResultRow(row int, result *SearchResult, palette *Palette) {
+	_, _, colmin, colmax := pane.GetTextBounds()
+	width := colmax - colmin + 1
+
+	SetPalette(palette)
+	defer SetPalette(DefaultPalette)
+
+	prefix := fmt.Sprintf("%s:%d  ", Truncate(result.Title, 24), result.Line)
+	snippetw := width - StringWidth(prefix)
+	if snippetw <= 0 {
+		DrawString(row, colmin, Truncate(prefix, width))
+		return
+	}
+
+	// Control characters are replaced around the match so it stays in place.
+	// Tabs would throw off the column math, so swap them 1:1 for spaces, then
+	// slide the visible window so the match is on screen.
+	start := util.Min(util.Max(result.Start, 0).Value, len(result.Text)).Value
+	end := util.Min(util.Max(result.End, start).Value, len(result.Text)).Value
+	before, match := SanitizeText(result.Text[:start]), SanitizeText(result.Text[start:end])
+	text := strings.ReplaceAll(before+match+SanitizeText(result.Text[end:]), "\t", " ")
+	trimmed := strings.TrimLeft(text, " ")
+	offset := len(text) - len(trimmed)
+	start, end = util.Max(len(before)-offset, 0).Value, util.Max(len(before)+len(match)-offset, 0).Value
+	start, end = util.Min(start, len(trimmed)).Value, util.Min(end, len(trimmed)).Value
+
+	lead := ""
+	if StringWidth(trimmed[:end]) > snippetw {
+		// Keep about a third of the line before the match
+		shift := start - len(tailWidth(trimmed[:start], snippetw/3))
+		trimmed, start, end = trimmed[shift:], start-shift, end-shift
+		lead = ELLIPSIS
+		snippetw -= StringWidth(lead)
+	}
+	trimmed, _ = splitWidth(trimmed, snippetw)
+	start = util.Min(start, len(trimmed)).Value
+	end = util.Min(end, len(trimmed)).Value
+
+	Move(row, colmin)
+	fmt.Printf("%s%s%s%s%s%s%s",
+		prefix,
+		lead,
+		trimmed[:start],
+		MATCH_HIGHLIGHT_ON,
+		trimmed[start:end],
+		MATCH_HIGHLIGHT_OFF,
+		trimmed[end:])
+	fmt.Print(strings.Repeat(" ", util.Max(width-StringWidth(prefix)-StringWidth(lead)-StringWidth(trimmed), 0).Value))
+}
+
+func ResultsPaneEventLoop(main *MainWindow, pane *ResultsPane) bool {
+	for {
+		switch ReadKey() {
+		case Key{Code: KEY_RESIZE}:
+			main.ResizeToTerminal()
+			main.Draw()
+			pane.Layout()
+		case Ctrl('c'), Key{Code: KEY_ESC}, Char('q'):
+			return false
+		case Key{Code: KEY_ENTER}:
+			return len(pane.Results) > 0
+		case Char('k'), Key{Code: KEY_UP}, Key{Code: KEY_WHEEL_UP}:
+			pane.SetSelection(pane.Selection - 1)
+		case Char('j'), Key{Code: KEY_DOWN}, Key{Code: KEY_WHEEL_DOWN}:
+			pane.SetSelection(pane.Selection + 1)
+		case Char('g'):
+			pane.SetSelection(0)
+		case Char('G'):
+			pane.SetSelection(len(pane.Results) - 1)
+		case Ctrl('u'):
+			pane.SetSelection(pane.Selection - util.Max(pane.PageSize()/2, 1).Value)
+		case Ctrl('d'):
+			pane.SetSelection(pane.Selection + util.Max(pane.PageSize()/2, 1).Value)
+		}
+		pane.Draw()
+	}
+}
+
+// RequestSearchResult shows the given results & returns the index of the one
+// chosen, or -1 if the pane was dismissed.
+func (window *MainWindow) RequestSearchResult(title string, results []*SearchResult) int {
+	pane := NewResultsPane(&window.Window, title, results)
+	pane.Draw()
+	defer window.Draw()
+
+	success := ResultsPaneEventLoop(window, pane)
+	if success {
+		return pane.Selection
+	}
+	return -1
+}
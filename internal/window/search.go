@@ -0,0 +1,133 @@
+package window
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/mrshanahan/notes-api/pkg/notes"
+	"mrshanahan.com/notes-term/internal/fuzzy"
+)
+
+// NoteRow is a single visible row of the note list. When a filter is active
+// the rows are a ranked subset of MainWindow.Notes.
+type NoteRow struct {
+	Note    *notes.Note
+	Index   int   // Index of the note in MainWindow.Notes
+	Matches []int // Byte offsets of title characters matched by the filter
+}
+
+// UpdateRows rebuilds the visible rows from the current notes & filter. The
+// selected note stays selected if it is still visible.
+func (window *MainWindow) UpdateRows() {
+	selected := window.SelectedNote()
+	if !window.sorted && window.Less != nil {
+		sort.SliceStable(window.Notes, func(i, j int) bool {
+			return window.Less(window.Notes[i], window.Notes[j])
+		})
+	}
+	window.sorted = true
+
+	titles := make([]string, len(window.Notes))
+	for i, n := range window.Notes {
+		titles[i] = n.Title
+	}
+	matches := fuzzy.Filter(window.Filter, titles)
+
+	rows := make([]*NoteRow, len(matches))
+	for i, m := range matches {
+		rows[i] = &NoteRow{window.Notes[m.Index], m.Index, m.Positions}
+		if selected != nil && rows[i].Note.ID == selected.ID {
+			window.Selection = i
+		}
+	}
+	window.Rows = rows
+	window.SetSelection(window.Selection)
+}
+
+// SetFilter changes the active filter & selects the best match.
+func (window *MainWindow) SetFilter(filter string) {
+	window.Filter = filter
+	window.Selection, window.ScrollOffset = 0, 0
+	window.Rows = nil
+	window.UpdateRows()
+}
+
+// SelectedNote returns the note under the cursor, or nil if no notes are
+// visible.
+func (window *MainWindow) SelectedNote() *notes.Note {
+	if window.Selection < 0 || window.Selection >= len(window.Rows) {
+		return nil
+	}
+	return window.Rows[window.Selection].Note
+}
+
+// SelectedIndex returns the index in Notes of the note under the cursor, or
+// -1 if no notes are visible.
+func (window *MainWindow) SelectedIndex() int {
+	if window.Selection < 0 || window.Selection >= len(window.Rows) {
+		return -1
+	}
+	return window.Rows[window.Selection].Index
+}
+
+func (window *MainWindow) ShowSearchBar() bool {
+	return window.Searching || window.Filter != ""
+}
+
+func (window *MainWindow) DrawSearchBar() {
+	row, _, _, _ := window.GetTextBounds()
+	colmin, colmax := window.GetListColumns()
+	width := colmax - colmin + 1
+
+	text := "/" + window.Filter
+	if !window.Searching {
+		text += "    (/ to edit, ESC to clear)"
+	}
+	count := fmt.Sprintf(" %d/%d", len(window.Rows), len(window.Notes))
+	DrawString(row, colmin, Pad(text, width-len(count))+count)
+}
+
+func (window *MainWindow) placeSearchCursor() {
+	row, _, colmin, _ := window.GetTextBounds()
+	Move(row, colmin+1+StringWidth(window.Filter))
+}
+
+// RequestFilter opens the search bar & filters the note list as the user
+// types. ENTER keeps the filter applied; ESC/CTRL+C clears it.
+func (window *MainWindow) RequestFilter() {
+	window.Searching = true
+	defer func() { window.Searching = false }()
+
+	ShowCursor()
+	defer HideCursor()
+
+	window.Draw()
+	window.placeSearchCursor()
+
+	for {
+		key := ReadKey()
+		switch key {
+		case Key{Code: KEY_RESIZE}:
+			window.ResizeToTerminal()
+		case Ctrl('c'), Key{Code: KEY_ESC}:
+			window.SetFilter("")
+			return
+		case Key{Code: KEY_ENTER}:
+			return
+		case Ctrl('n'), Key{Code: KEY_DOWN}, Key{Code: KEY_WHEEL_DOWN}:
+			window.SetSelection(window.Selection + 1)
+		case Ctrl('p'), Key{Code: KEY_UP}, Key{Code: KEY_WHEEL_UP}:
+			window.SetSelection(window.Selection - 1)
+		case Key{Code: KEY_BACKSPACE}:
+			if len(window.Filter) > 0 {
+				window.SetFilter(dropLastSymbol(window.Filter))
+			}
+		default:
+			if key.Printable() {
+				window.SetFilter(window.Filter + string(key.Rune))
+			}
+		}
+		window.Draw()
+		window.placeSearchCursor()
+	}
+}
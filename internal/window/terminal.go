@@ -0,0 +1,110 @@
+package window
+
+import (
+	"os"
+	"os/signal"
+
+	unix "golang.org/x/sys/unix"
+)
+
+var (
+	notifyReader *os.File
+	notifyWriter *os.File
+)
+
+// ListenForResize starts watching for SIGWINCH. Once called, ReadKey will
+// return KEY_RESIZE whenever the terminal size changes, even while blocked
+// waiting for a key press.
+func ListenForResize() error {
+	if err := ensureNotifyPipe(); err != nil {
+		return err
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, unix.SIGWINCH)
+	go func() {
+		for range sigs {
+			notifyWriter.Write([]byte{'r'})
+		}
+	}()
+	return nil
+}
+
+// PostRefresh wakes up whoever is blocked in ReadKey, which returns
+// KEY_REFRESH. Safe to call from any goroutine.
+func PostRefresh() {
+	if notifyWriter != nil {
+		notifyWriter.Write([]byte{'u'})
+	}
+}
+
+func ensureNotifyPipe() error {
+	if notifyReader != nil {
+		return nil
+	}
+
+	r, wr, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	notifyReader, notifyWriter = r, wr
+	return nil
+}
+
+// GetTerminalSize returns the current width & height of the terminal.
+func GetTerminalSize() (int, int, error) {
+	ws, err := unix.IoctlGetWinsize(int(os.Stdout.Fd()), unix.TIOCGWINSZ)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(ws.Col), int(ws.Row), nil
+}
+
+// waitForInput blocks until either stdin has data or a notification arrives.
+// It returns the synthetic key for the notification, or false if there is
+// input to read.
+func waitForInput() (Key, bool) {
+	if notifyReader == nil {
+		return Key{}, false
+	}
+
+	fds := []unix.PollFd{
+		{Fd: int32(os.Stdin.Fd()), Events: unix.POLLIN},
+		{Fd: int32(notifyReader.Fd()), Events: unix.POLLIN},
+	}
+	for {
+		_, err := unix.Poll(fds, -1)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return Key{}, false
+		}
+		break
+	}
+
+	if fds[1].Revents&unix.POLLIN != 0 {
+		return drainNotifications(), true
+	}
+	return Key{}, false
+}
+
+// drainNotifications consumes every pending notification. A resize implies a
+// full redraw, so it takes precedence over refreshes.
+func drainNotifications() Key {
+	result := Key{Code: KEY_REFRESH}
+	buf := make([]byte, 64)
+	for {
+		fds := []unix.PollFd{{Fd: int32(notifyReader.Fd()), Events: unix.POLLIN}}
+		n, err := unix.Poll(fds, 0)
+		if err != nil || n == 0 {
+			return result
+		}
+		n, _ = notifyReader.Read(buf)
+		for _, b := range buf[:n] {
+			if b == 'r' {
+				result = Key{Code: KEY_RESIZE}
+			}
+		}
+	}
+}
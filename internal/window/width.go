@@ -0,0 +1,243 @@
+package window
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"mrshanahan.com/notes-term/internal/util"
+)
+
+// Text on screen is measured in columns rather than bytes or runes: East
+// Asian wide characters & most emoji take two columns, combining marks &
+// joiners take none. A character together with whatever combines with it
+// (accents, skin tones, emoji joined with ZWJ, the two halves of a flag) is
+// one symbol, & is only ever measured or cut as a whole.
+
+// Shown at the end of text that's been cut short
+const ELLIPSIS = "..."
+
+const (
+	ZERO_WIDTH_JOINER     = '\u200d'
+	VARIATION_SELECTOR_16 = '\ufe0f' // Asks for emoji presentation, i.e. two columns
+)
+
+// wideRanges are the characters taking two columns: East Asian Wide &
+// Fullwidth characters & emoji shown as emoji by default. Sorted, inclusive.
+var wideRanges = [][2]rune{
+	{0x1100, 0x115f}, {0x231a, 0x231b}, {0x2329, 0x232a}, {0x23e9, 0x23ec},
+	{0x23f0, 0x23f0}, {0x23f3, 0x23f3}, {0x25fd, 0x25fe}, {0x2614, 0x2615},
+	{0x2648, 0x2653}, {0x267f, 0x267f}, {0x2693, 0x2693}, {0x26a1, 0x26a1},
+	{0x26aa, 0x26ab}, {0x26bd, 0x26be}, {0x26c4, 0x26c5}, {0x26ce, 0x26ce},
+	{0x26d4, 0x26d4}, {0x26ea, 0x26ea}, {0x26f2, 0x26f3}, {0x26f5, 0x26f5},
+	{0x26fa, 0x26fa}, {0x26fd, 0x26fd}, {0x2705, 0x2705}, {0x270a, 0x270b},
+	{0x2728, 0x2728}, {0x274c, 0x274c}, {0x274e, 0x274e}, {0x2753, 0x2755},
+	{0x2757, 0x2757}, {0x2795, 0x2797}, {0x27b0, 0x27b0}, {0x27bf, 0x27bf},
+	{0x2b1b, 0x2b1c}, {0x2b50, 0x2b50}, {0x2b55, 0x2b55}, {0x2e80, 0x303e},
+	{0x3041, 0x33ff}, {0x3400, 0x4dbf}, {0x4e00, 0x9fff}, {0xa000, 0xa4cf},
+	{0xa960, 0xa97f}, {0xac00, 0xd7a3}, {0xf900, 0xfaff}, {0xfe10, 0xfe19},
+	{0xfe30, 0xfe6f}, {0xff00, 0xff60}, {0xffe0, 0xffe6}, {0x16fe0, 0x16fe4},
+	{0x17000, 0x18cff}, {0x1b000, 0x1b2ff}, {0x1f004, 0x1f004}, {0x1f0cf, 0x1f0cf},
+	{0x1f18e, 0x1f18e}, {0x1f191, 0x1f19a}, {0x1f200, 0x1f202}, {0x1f210, 0x1f23b},
+	{0x1f240, 0x1f248}, {0x1f250, 0x1f251}, {0x1f260, 0x1f265}, {0x1f300, 0x1f320},
+	{0x1f32d, 0x1f335}, {0x1f337, 0x1f37c}, {0x1f37e, 0x1f393}, {0x1f3a0, 0x1f3ca},
+	{0x1f3cf, 0x1f3d3}, {0x1f3e0, 0x1f3f0}, {0x1f3f4, 0x1f3f4}, {0x1f3f8, 0x1f43e},
+	{0x1f440, 0x1f440}, {0x1f442, 0x1f4fc}, {0x1f4ff, 0x1f53d}, {0x1f54b, 0x1f54e},
+	{0x1f550, 0x1f567}, {0x1f57a, 0x1f57a}, {0x1f595, 0x1f596}, {0x1f5a4, 0x1f5a4},
+	{0x1f5fb, 0x1f64f}, {0x1f680, 0x1f6c5}, {0x1f6cc, 0x1f6cc}, {0x1f6d0, 0x1f6d2},
+	{0x1f6d5, 0x1f6d7}, {0x1f6dc, 0x1f6df}, {0x1f6eb, 0x1f6ec}, {0x1f6f4, 0x1f6fc},
+	{0x1f7e0, 0x1f7eb}, {0x1f7f0, 0x1f7f0}, {0x1f90c, 0x1f93a}, {0x1f93c, 0x1f945},
+	{0x1f947, 0x1f9ff}, {0x1fa70, 0x1faff}, {0x20000, 0x2fffd}, {0x30000, 0x3fffd},
+}
+
+// RuneWidth returns how many columns r takes on its own.
+func RuneWidth(r rune) int {
+	switch {
+	case r < 0x20 || (r >= 0x7f && r < 0xa0):
+		return 0
+	case r < 0x300:
+		return 1
+	case combines(r):
+		return 0
+	}
+	i := sort.Search(len(wideRanges), func(i int) bool { return wideRanges[i][1] >= r })
+	if i < len(wideRanges) && r >= wideRanges[i][0] {
+		return 2
+	}
+	return 1
+}
+
+// combines returns true if r joins onto the symbol before it rather than
+// starting one of its own.
+func combines(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) ||
+		// Hangul vowels & final consonants that build syllables out of jamo
+		(r >= 0x1160 && r <= 0x11ff) ||
+		// Emoji skin tones
+		(r >= 0x1f3fb && r <= 0x1f3ff)
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1f1e6 && r <= 0x1f1ff
+}
+
+// nextSymbol returns the length in bytes & the width of the symbol at the
+// start of s.
+func nextSymbol(s string) (int, int) {
+	r, n := utf8.DecodeRuneInString(s)
+	width := RuneWidth(r)
+	if r < 0x20 {
+		// Control characters never combine
+		return n, width
+	}
+	prev, flag := r, isRegionalIndicator(r)
+	for n < len(s) {
+		next, size := utf8.DecodeRuneInString(s[n:])
+		switch {
+		case prev == ZERO_WIDTH_JOINER && next >= 0x20:
+			// Joined into the same symbol, e.g. a family emoji
+		case next == VARIATION_SELECTOR_16:
+			width = 2
+		case combines(next):
+		case flag && isRegionalIndicator(next):
+			// A pair of these is a flag
+			flag, width = false, 2
+		default:
+			return n, width
+		}
+		prev, n = next, n+size
+	}
+	return n, width
+}
+
+// SanitizeText replaces whatever the terminal would take as a control rather
+// than text with a visible stand-in, so that text from notes can't move the
+// cursor, retitle the window or the like: C0 controls & DEL in caret
+// notation (e.g. "^[" for ESC), C1 controls & invalid UTF-8 with U+FFFD.
+// Newlines & tabs are kept for the caller to lay out.
+func SanitizeText(s string) string {
+	clean := true
+	for _, r := range s {
+		if isControl(r) || r == utf8.RuneError {
+			clean = false
+			break
+		}
+	}
+	if clean {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		r, n := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && n <= 1:
+			b.WriteRune(utf8.RuneError)
+		case !isControl(r):
+			b.WriteString(s[i : i+n])
+		case r < 0x20 || r == 0x7f:
+			b.WriteByte('^')
+			b.WriteByte(byte(r) ^ 0x40)
+		default:
+			b.WriteRune(utf8.RuneError)
+		}
+		i += n
+	}
+	return b.String()
+}
+
+// isControl returns true for the C0 & C1 controls & DEL, other than newline
+// & tab.
+func isControl(r rune) bool {
+	return (r < 0x20 && r != '\n' && r != '\t') || (r >= 0x7f && r <= 0x9f)
+}
+
+// StringWidth returns how many columns s takes on screen.
+func StringWidth(s string) int {
+	width := 0
+	for i := 0; i < len(s); {
+		n, w := nextSymbol(s[i:])
+		width, i = width+w, i+n
+	}
+	return width
+}
+
+// splitWidth splits s after as many whole symbols as fit in width columns.
+func splitWidth(s string, width int) (string, string) {
+	used := 0
+	for i := 0; i < len(s); {
+		n, w := nextSymbol(s[i:])
+		if used+w > width {
+			return s[:i], s[i:]
+		}
+		used, i = used+w, i+n
+	}
+	return s, ""
+}
+
+// wrapWidth is splitWidth for wrapping text: if not even the first symbol
+// fits it's taken anyway, so that every line makes progress.
+func wrapWidth(s string, width int) (string, string) {
+	head, rest := splitWidth(s, width)
+	if head == "" && s != "" {
+		n, _ := nextSymbol(s)
+		return s[:n], s[n:]
+	}
+	return head, rest
+}
+
+// tailWidth returns as many whole symbols from the end of s as fit in width
+// columns.
+func tailWidth(s string, width int) string {
+	starts, widths := []int{}, []int{}
+	for i := 0; i < len(s); {
+		n, w := nextSymbol(s[i:])
+		starts, widths = append(starts, i), append(widths, w)
+		i += n
+	}
+	start, used := len(s), 0
+	for i := len(starts) - 1; i >= 0 && used+widths[i] <= width; i-- {
+		start, used = starts[i], used+widths[i]
+	}
+	return s[start:]
+}
+
+// dropLastSymbol returns s without its last symbol, e.g. for backspace.
+func dropLastSymbol(s string) string {
+	last := 0
+	for i := 0; i < len(s); {
+		n, _ := nextSymbol(s[i:])
+		last, i = i, i+n
+	}
+	return s[:last]
+}
+
+// truncateParts is Truncate with the part of s that's kept & the ellipsis (if
+// any) returned separately.
+func truncateParts(s string, width int) (string, string) {
+	if StringWidth(s) <= width {
+		return s, ""
+	}
+	ellipsisw := StringWidth(ELLIPSIS)
+	if width < ellipsisw {
+		head, _ := splitWidth(s, width)
+		return head, ""
+	}
+	head, _ := splitWidth(s, width-ellipsisw)
+	return head, ELLIPSIS
+}
+
+// Truncate cuts s down to at most width columns, ending it with ELLIPSIS if
+// anything was cut.
+func Truncate(s string, width int) string {
+	head, ellipsis := truncateParts(s, width)
+	return head + ellipsis
+}
+
+// Pad truncates s to width columns (see Truncate) & fills out the rest with
+// spaces.
+func Pad(s string, width int) string {
+	s = Truncate(s, width)
+	return s + strings.Repeat(" ", util.Max(width-StringWidth(s), 0).Value)
+}
@@ -0,0 +1,175 @@
+package window
+
+import (
+	"testing"
+)
+
+const (
+	family  = "👨\u200d👩\u200d👧"
+	heart   = "❤\ufe0f"
+	flag    = "🇩🇪"
+	thumbs  = "👍\U0001f3fd"
+	eAcute  = "e\u0301"
+	hangul  = "\u1100\u1161\u11a8"
+	control = "\x01"
+)
+
+func TestNextSymbol(t *testing.T) {
+	tests := []struct {
+		name  string
+		s     string
+		n     int
+		width int
+	}{
+		{"ASCII", "ab", 1, 1},
+		{"precomposed", "éa", 2, 1},
+		{"combining mark", eAcute + "x", 3, 1},
+		{"several combining marks", "a\u0323\u0301b", 5, 1},
+		{"wide", "日本", 3, 2},
+		{"ZWJ sequence", family + "x", len(family), 2},
+		{"ZWJ at the end", "a\u200d", 4, 1},
+		{"VS16", heart + "x", len(heart), 2},
+		{"without VS16", "❤x", 3, 1},
+		{"flag", flag + "x", len(flag), 2},
+		{"flags", flag + flag, len(flag), 2},
+		{"lone regional indicator", "🇩x", 4, 1},
+		{"skin tone", thumbs + "x", len(thumbs), 2},
+		{"Hangul jamo", hangul + "x", len(hangul), 2},
+		{"control", control + "\u0301", 1, 0},
+	}
+	for _, test := range tests {
+		n, width := nextSymbol(test.s)
+		if n != test.n || width != test.width {
+			t.Errorf("%s: nextSymbol(%q) = %d, %d; want %d, %d", test.name, test.s, n, width, test.n, test.width)
+		}
+	}
+}
+
+func TestStringWidth(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{"", 0},
+		{"notes", 5},
+		{"日本語", 6},
+		{"a" + family + "b", 4},
+		{heart + heart, 4},
+		{flag + flag + "🇫", 5},
+		{eAcute + eAcute, 2},
+		{thumbs + " ok", 5},
+	}
+	for _, test := range tests {
+		if got := StringWidth(test.s); got != test.want {
+			t.Errorf("StringWidth(%q) = %d, want %d", test.s, got, test.want)
+		}
+	}
+}
+
+func TestSplitWidth(t *testing.T) {
+	tests := []struct {
+		s     string
+		width int
+		head  string
+		rest  string
+	}{
+		{"abc", 2, "ab", "c"},
+		{"abc", 5, "abc", ""},
+		{"abc", 0, "", "abc"},
+		{"日本語", 3, "日", "本語"},
+		{"日本語", 4, "日本", "語"},
+		{"a" + family + "b", 2, "a", family + "b"},
+		{"a" + family + "b", 3, "a" + family, "b"},
+		{eAcute + "x", 1, eAcute, "x"},
+		{flag + flag, 3, flag, flag},
+		{"x" + heart, 2, "x", heart},
+		{thumbs + "a", 2, thumbs, "a"},
+	}
+	for _, test := range tests {
+		head, rest := splitWidth(test.s, test.width)
+		if head != test.head || rest != test.rest {
+			t.Errorf("splitWidth(%q, %d) = %q, %q; want %q, %q", test.s, test.width, head, rest, test.head, test.rest)
+		}
+	}
+}
+
+func TestTailWidth(t *testing.T) {
+	tests := []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{"abc", 2, "bc"},
+		{"abc", 0, ""},
+		{"abc", 9, "abc"},
+		{"日本語", 3, "語"},
+		{"ab" + flag, 3, "b" + flag},
+		{"x" + heart, 2, heart},
+		{"x" + family, 1, ""},
+		{"ab" + eAcute, 2, "b" + eAcute},
+		{"a" + thumbs, 2, thumbs},
+	}
+	for _, test := range tests {
+		if got := tailWidth(test.s, test.width); got != test.want {
+			t.Errorf("tailWidth(%q, %d) = %q, want %q", test.s, test.width, got, test.want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{"notes", 5, "notes"},
+		{"notes", 4, "n..."},
+		{"notes", 2, "no"},
+		{"日本語", 6, "日本語"},
+		{"日本語", 5, "日..."},
+		{"日本語テキスト", 7, "日本..."},
+		// The symbol that would straddle the budget is dropped whole
+		{"日本語", 4, "..."},
+		{thumbs + thumbs + thumbs, 5, thumbs + "..."},
+		{family + family + family, 5, family + "..."},
+		{flag + flag + flag, 6, flag + flag + flag},
+		{flag + flag + flag, 5, flag + "..."},
+		{eAcute + eAcute + eAcute + eAcute + eAcute, 4, eAcute + "..."},
+		{heart + heart, 3, "..."},
+	}
+	for _, test := range tests {
+		got := Truncate(test.s, test.width)
+		if got != test.want {
+			t.Errorf("Truncate(%q, %d) = %q, want %q", test.s, test.width, got, test.want)
+		}
+		if StringWidth(got) > test.width {
+			t.Errorf("Truncate(%q, %d) is %d columns wide", test.s, test.width, StringWidth(got))
+		}
+	}
+}
+
+func TestPad(t *testing.T) {
+	tests := []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{"ab", 4, "ab  "},
+		{"日本", 5, "日本 "},
+		{"日本語", 5, "日..."},
+		{"日本語", 4, "... "},
+		{flag, 3, flag + " "},
+		{eAcute, 3, eAcute + "  "},
+		{heart, 2, heart},
+		{family + "x", 4, family + "x "},
+	}
+	for _, test := range tests {
+		got := Pad(test.s, test.width)
+		if got != test.want {
+			t.Errorf("Pad(%q, %d) = %q, want %q", test.s, test.width, got, test.want)
+		}
+		if StringWidth(got) != test.width {
+			t.Errorf("Pad(%q, %d) is %d columns wide", test.s, test.width, StringWidth(got))
+		}
+	}
+}
@@ -3,13 +3,13 @@ package window
 import (
     // "errors"
     "fmt"
-    "os"
     "strings"
     // term "golang.org/x/term"
     termios "github.com/pkg/term/termios"
     unix "golang.org/x/sys/unix"
 
     "github.com/mrshanahan/notes-api/pkg/notes"
+    "mrshanahan.com/notes-term/internal/paths"
     "mrshanahan.com/notes-term/internal/util"
 )
 
@@ -24,13 +24,19 @@ const (
     BOX_DOUBLE_VERTICAL_LEFT = '\u2563'
     BOX_DOUBLE_HORIZONTAL_DOWN = '\u2566'
     BOX_DOUBLE_HORIZONTAL_UP = '\u2569'
+    SCROLLBAR_TRACK = '\u2551'
+    SCROLLBAR_THUMB = '\u2588'
 
     DEFAULT_BACKGROUND_COLOR = 46 // cyan
     DEFAULT_FOREGROUND_COLOR = 37 // white
     HIGHLIGHT_BACKGROUND_COLOR = 47 // white
     HIGHLIGHT_FOREGROUND_COLOR = 36 // cyan
+    MATCH_HIGHLIGHT_ON = "\033[1;4m" // bold, underline
+    MATCH_HIGHLIGHT_OFF = "\033[22;24m"
     ERROR_BACKGROUND_COLOR = 41 // red
     ERROR_FOREGROUND_COLOR = 37 // white
+    CODE_BACKGROUND_COLOR = 40 // black
+    CODE_FOREGROUND_COLOR = 33 // yellow
 )
 
 var (
@@ -46,6 +52,10 @@ var (
         ERROR_BACKGROUND_COLOR,
         ERROR_FOREGROUND_COLOR,
     }
+    CodePalette = &Palette{
+        CODE_BACKGROUND_COLOR,
+        CODE_FOREGROUND_COLOR,
+    }
     Debug = false
 )
 
@@ -68,17 +78,119 @@ type Window struct {
 type MainWindow struct {
     Window
     Selection int
+    ScrollOffset int
     Notes []*notes.Note
+    Rows []*NoteRow
+    Filter string
+    Searching bool
+    Preview *PreviewPane
+    ShowPreview bool
     LastKeyWindow *TextLabel
     HelpWindow *MultilineTextLabel
     HelpCollapsedLabel *TextLabel
     HelpCollapsed bool
+    // Shown in the top border unless it's the default profile
+    Profile string
+    // Lines shown in the help panel & the key that opens it
+    HelpText []string
+    HelpKey string
+    // Order of the note list; if nil, notes are shown in the order given.
+    // Change it with SetSort.
+    Less func(a, b *notes.Note) bool
+    // Whether Notes is already in Less order; see NotesChanged
+    sorted bool
+    // Whether moving past either end of the list goes round to the other
+    WrapSelection bool
 }
 
 func NewMainWindow(termw, termh int, notes []*notes.Note) *MainWindow {
+    window := &MainWindow{
+        Window: Window{0, 0, termw, termh, true, []int{}},
+        Notes: notes,
+        HelpCollapsed: true,
+        HelpKey: "CTRL+H",
+        WrapSelection: true,
+    }
+    window.layout()
+    window.UpdateRows()
+    return window
+}
+
+// EnablePreview adds a pane to the right of the note list showing the
+// content of the selected note, loaded from source.
+func (window *MainWindow) EnablePreview(source ContentSource) {
+    window.Preview = NewPreviewPane(source)
+    window.ShowPreview = true
+    window.layout()
+}
+
+// SetHelpText replaces the lines shown in the help panel & the key shown for
+// opening it, e.g. after the keys have been remapped.
+func (window *MainWindow) SetHelpText(lines []string, helpKey string) {
+    window.HelpText, window.HelpKey = lines, helpKey
+    window.layout()
+}
+
+// SetNotes replaces the notes shown, e.g. after switching to another server,
+// clearing the filter & selection.
+func (window *MainWindow) SetNotes(notes []*notes.Note) {
+    window.Notes = notes
+    window.sorted = false
+    window.SetFilter("")
+}
+
+// SetSort changes the order of the note list; nil keeps the order given.
+func (window *MainWindow) SetSort(less func(a, b *notes.Note) bool) {
+    window.Less = less
+    window.sorted = false
+}
+
+// NotesChanged has the note list sorted again on the next draw. Call it after
+// adding to Notes or changing a note in it.
+func (window *MainWindow) NotesChanged() {
+    window.sorted = false
+}
+
+// PreviewVisible returns true if the preview pane is enabled & there is room
+// on screen for it.
+func (window *MainWindow) PreviewVisible() bool {
+    return window.Preview != nil && window.ShowPreview && window.Width >= PREVIEW_MIN_WIDTH
+}
+
+// GetListColumns returns the columns available for drawing notes. When the
+// preview is visible the list takes the left part of the window, leaving room
+// for the help panel.
+func (window *MainWindow) GetListColumns() (int, int) {
+    _, _, colmin, colmax := window.GetTextBounds()
+    if !window.PreviewVisible() {
+        return colmin, colmax
+    }
+    listw := util.Max((colmax-colmin+1)*2/5, window.HelpWindow.Width, 30).Value
+    return colmin, colmin+listw-1
+}
+
+// Resize updates the main window to the given terminal dimensions and
+// recomputes the geometry of all of its child widgets.
+func (window *MainWindow) Resize(termw, termh int) {
+    window.Width, window.Height = termw, termh
+    window.layout()
+}
+
+// ResizeToTerminal resizes the main window to the current terminal size,
+// returning true if the size actually changed.
+func (window *MainWindow) ResizeToTerminal() bool {
+    termw, termh, err := GetTerminalSize()
+    if err != nil || (termw == window.Width && termh == window.Height) {
+        return false
+    }
+    window.Resize(termw, termh)
+    ClearScreen()
+    return true
+}
+
+func (window *MainWindow) layout() {
     // TODO: This is nasty. Make this all constructable at once & w/o repeating
     //       the logic of GetTextBounds() in multiple places.
-    window := &MainWindow{Window{0, 0, termw, termh, true, []int{}}, 0, notes, nil, nil, nil, true}
     _, rowmax, colmin, colmax := window.GetTextBounds()
 
     lastkeyw, lastkeyh := 22, 3
@@ -89,19 +201,18 @@ func NewMainWindow(termw, termh int, notes []*notes.Note) *MainWindow {
         BOX_DOUBLE_HORIZONTAL_UP,
         BOX_DOUBLE_LOWER_RIGHT,
     }
-    lastKey := NewSizedBorderedTextLabel(lastkeyx, lastkeyy, lastkeyw, lastkeyh, "", lastkeyBordering)
+    lastKeyValue := ""
+    if window.LastKeyWindow != nil {
+        lastKeyValue = window.LastKeyWindow.Value
+    }
+    lastKey := NewSizedBorderedTextLabel(lastkeyx, lastkeyy, lastkeyw, lastkeyh, lastKeyValue, lastkeyBordering)
     window.LastKeyWindow = lastKey
 
-    helpText := []string{
-        "j/k       Up/down",
-        "CTRL+N    Create note",
-        "CTRL+R    Rename note",
-        "CTRL+D    Delete note",
-        "CTRL+I    Import note",
-        "Enter     Edit note",
-        "q/CTRL+C  Exit",
+    helpText := window.HelpText
+    helpw := 2
+    if longest := util.MaxBy(helpText, func (x string) int { return StringWidth(x) }); longest != nil {
+        helpw += StringWidth(longest.Value)
     }
-    helpw := len(util.MaxBy(helpText, func (x string) int { return len(x) }).Value) + 2
     helph := len(helpText) + 2
     helpx, helpy := colmin-2, rowmax-helph+1
     helpBordering := []int{
@@ -113,13 +224,18 @@ func NewMainWindow(termw, termh int, notes []*notes.Note) *MainWindow {
     helpWindow := NewSizedBorderedMultilineTextLabel(helpx, helpy, helpw, helph, helpText, helpBordering)
     window.HelpWindow = helpWindow
 
-    collapseText := "CTRL+H to open help"
-    collapsew, collapseh := len(collapseText)+2, 3
+    collapseText := window.HelpKey + " to open help"
+    collapsew, collapseh := StringWidth(collapseText)+2, 3
     collapsex, collapsey := colmin-2, rowmax-collapseh+1
     collapseLabel := NewSizedBorderedTextLabel(collapsex, collapsey, collapsew, collapseh, collapseText, helpBordering)
     window.HelpCollapsedLabel = collapseLabel
 
-    return window
+    if window.Preview != nil {
+        rowmin, rowmax, _, _ := window.GetTextBounds()
+        _, listmax := window.GetListColumns()
+        // One column between the list & the preview for the divider
+        window.Preview.SetBounds(rowmin, rowmax, listmax+2, colmax)
+    }
 }
 
 type TextLabel struct {
@@ -128,11 +244,11 @@ type TextLabel struct {
 }
 
 func NewTextLabel(x, y int, value string) *TextLabel {
-    return &TextLabel{Window{x, y, len(value), 1, false, []int{}}, value}
+    return &TextLabel{Window{x, y, StringWidth(value), 1, false, []int{}}, value}
 }
 
 func NewBorderedTextLabel(x, y int, value string) *TextLabel {
-    return &TextLabel{Window{x, y, len(value)+2, 3, true, []int{}}, value}
+    return &TextLabel{Window{x, y, StringWidth(value)+2, 3, true, []int{}}, value}
 }
 
 func NewSizedBorderedTextLabel(x, y, w, h int, value string, bordering []int) *TextLabel {
@@ -185,11 +301,14 @@ func (w Window) GetTextBounds() (int, int, int, int) {
            w.X + w.Width + sizemod
 }
 
-func ReadInput() uint32 {
-    inputBuf := make([]byte, 4)
-    os.Stdin.Read(inputBuf)
-    input := util.LEBytesToUInt32(inputBuf)
-    return input
+// Contains returns true if the screen position (as given to Move) is within
+// the window, borders included.
+func (w Window) Contains(row, col int) bool {
+    rowmin, rowmax, colmin, colmax := w.GetTextBounds()
+    if w.HasBorders {
+        rowmin, rowmax, colmin, colmax = rowmin-1, rowmax+1, colmin-1, colmax+1
+    }
+    return row >= rowmin && row <= rowmax && col >= colmin && col <= colmax
 }
 
 func Move(row, col int) {
@@ -212,6 +331,17 @@ func ShowCursor() {
     fmt.Print("\033[?25h")
 }
 
+// EnableMouse asks the terminal to report clicks & the wheel, which ReadKey
+// returns as mouse keys. Turn it off again with DisableMouse before exiting or
+// handing the terminal to another program.
+func EnableMouse() {
+    fmt.Print("\033[?1000h\033[?1006h")
+}
+
+func DisableMouse() {
+    fmt.Print("\033[?1006l\033[?1000l")
+}
+
 func DrawChar(r, c int, b int) {
     Move(r, c)
     fmt.Printf("%c", b)
@@ -260,31 +390,150 @@ func (window *Window) DrawInterior() {
     }
 }
 
-func DrawNoteRow(window *MainWindow, noteIdx int, palette *Palette) {
-    rowmin, _, colmin, colmax := window.GetTextBounds()
-    if noteIdx < 0 || noteIdx >= len(window.Notes) {
-        panic(fmt.Sprintf("attempted to draw nonexistent note index: %d", noteIdx))
+// GetListBounds returns the rows available for drawing notes, i.e. the text
+// area of the window minus whatever the help panel is currently covering.
+func (window *MainWindow) GetListBounds() (int, int) {
+    rowmin, _, _, _ := window.GetTextBounds()
+    var panel Window
+    if window.HelpCollapsed {
+        panel = window.HelpCollapsedLabel.Window
+    } else {
+        panel = window.HelpWindow.Window
+    }
+    if window.ShowSearchBar() {
+        rowmin += 1
+    }
+    // Panel's top border sits at panel.Y+1, so the last free row is panel.Y.
+    return rowmin, panel.Y
+}
+
+// PageSize returns the number of note rows visible at once.
+func (window *MainWindow) PageSize() int {
+    rowmin, rowmax := window.GetListBounds()
+    return util.Max(rowmax-rowmin+1, 1).Value
+}
+
+// SetSelection selects the note at idx, clamped to the list, and scrolls the
+// viewport so that it is visible.
+func (window *MainWindow) SetSelection(idx int) {
+    idx = util.Min(idx, len(window.Rows)-1).Value
+    idx = util.Max(idx, 0).Value
+    window.Selection = idx
+    window.scrollToSelection()
+}
+
+// MoveSelection moves the selection by delta rows, going round to the other
+// end of the list when it runs off one if WrapSelection is set.
+func (window *MainWindow) MoveSelection(delta int) {
+    idx := window.Selection + delta
+    if window.WrapSelection && len(window.Rows) > 0 {
+        if idx < 0 {
+            idx = len(window.Rows) - 1
+        } else if idx >= len(window.Rows) {
+            idx = 0
+        }
+    }
+    window.SetSelection(idx)
+}
+
+// RowAt returns the index of the note row shown at the screen position, or -1
+// if there isn't one there.
+func (window *MainWindow) RowAt(row, col int) int {
+    rowmin, rowmax := window.GetListBounds()
+    colmin, colmax := window.GetListColumns()
+    if row < rowmin || row > rowmax || col < colmin || col > colmax {
+        return -1
+    }
+    idx := row - rowmin + window.ScrollOffset
+    if idx >= len(window.Rows) {
+        return -1
+    }
+    return idx
+}
+
+func (window *MainWindow) scrollToSelection() {
+    pagesize := window.PageSize()
+    if window.Selection < window.ScrollOffset {
+        window.ScrollOffset = window.Selection
+    } else if window.Selection >= window.ScrollOffset+pagesize {
+        window.ScrollOffset = window.Selection - pagesize + 1
     }
+    maxoffset := util.Max(len(window.Rows)-pagesize, 0).Value
+    window.ScrollOffset = util.Min(window.ScrollOffset, maxoffset).Value
+    window.ScrollOffset = util.Max(window.ScrollOffset, 0).Value
+}
 
-    row, col := noteIdx + rowmin, colmin
+func DrawNoteRow(window *MainWindow, rowIdx int, palette *Palette) {
+    rowmin, _ := window.GetListBounds()
+    colmin, colmax := window.GetListColumns()
+    if rowIdx < 0 || rowIdx >= len(window.Rows) {
+        panic(fmt.Sprintf("attempted to draw nonexistent note row: %d", rowIdx))
+    }
+
+    row, col := rowIdx - window.ScrollOffset + rowmin, colmin
     Move(row, col)
     SetPalette(palette)
     defer SetPalette(DefaultPalette)
-    // fmt.Printf("\033[%dm", palette.Background)
-    // fmt.Printf("\033[%dm", palette.Foreground)
 
-    note := window.Notes[noteIdx]
-    contents := note.Title
-    padding := colmax - rowmin - len(contents) + 1
-    if padding < 0 {
-        padding = 0
-        contents = contents[:colmax-rowmin-2] + "..."
+    noteRow := window.Rows[rowIdx]
+    width := colmax - colmin + 1
+    contents, suffix := truncateParts(noteRow.Note.Title, width)
+    padding := util.Max(width - StringWidth(contents) - len(suffix), 0).Value
+
+    matched := map[int]bool{}
+    for _, p := range noteRow.Matches {
+        matched[p] = true
+    }
+    // A symbol is highlighted whole, so that accents etc. stay attached
+    for i := 0; i < len(contents); {
+        n, _ := nextSymbol(contents[i:])
+        if matched[i] {
+            fmt.Printf("%s%s%s", MATCH_HIGHLIGHT_ON, contents[i:i+n], MATCH_HIGHLIGHT_OFF)
+        } else {
+            fmt.Print(contents[i:i+n])
+        }
+        i += n
     }
     padstring := strings.Repeat(" ", padding)
-    fmt.Printf("%s%s", contents, padstring)
+    fmt.Printf("%s%s", suffix, padstring)
+}
+
+// DrawScrollIndicator draws a scrollbar along the right border of the note
+// list along with the current position in the top border. Nothing is drawn if
+// every note fits on screen.
+func (window *MainWindow) DrawScrollIndicator() {
+    rowmin, rowmax := window.GetListBounds()
+    textrowmin, _, _, _ := window.GetTextBounds()
+    _, colmax := window.GetListColumns()
+    pagesize := window.PageSize()
+    total := len(window.Rows)
+    if total <= pagesize {
+        return
+    }
+
+    position := fmt.Sprintf(" %d/%d ", window.Selection+1, total)
+    DrawString(textrowmin-1, colmax-len(position), position)
+
+    trackh := rowmax - rowmin + 1
+    thumbh := util.Max(trackh*pagesize/total, 1).Value
+    thumby := rowmin + (trackh-thumbh)*window.ScrollOffset/(total-pagesize)
+    for r := rowmin; r <= rowmax; r++ {
+        if r >= thumby && r < thumby+thumbh {
+            DrawChar(r, colmax+1, SCROLLBAR_THUMB)
+        } else {
+            DrawChar(r, colmax+1, SCROLLBAR_TRACK)
+        }
+    }
+}
 
-    // fmt.Printf("\033[%dm", DefaultPalette.Background)
-    // fmt.Printf("\033[%dm", DefaultPalette.Foreground) }
+// DrawProfile labels the top border with the active profile.
+func (window *MainWindow) DrawProfile() {
+    if window.Profile == "" || window.Profile == paths.DEFAULT_PROFILE {
+        return
+    }
+    textrowmin, _, textcolmin, textcolmax := window.GetTextBounds()
+    label := Truncate(fmt.Sprintf(" %s ", window.Profile), (textcolmax-textcolmin)/2)
+    DrawString(textrowmin-1, textcolmin+1, label)
 }
 
 func (window *MainWindow) Draw() {
@@ -299,13 +548,40 @@ func (window *MainWindow) Draw() {
         window.HelpWindow.Draw()
     }
 
-    for i, _ := range window.Notes {
+    window.UpdateRows()
+    window.scrollToSelection()
+    if window.ShowSearchBar() {
+        window.DrawSearchBar()
+    }
+    last := util.Min(window.ScrollOffset+window.PageSize(), len(window.Rows)).Value
+    for i := window.ScrollOffset; i < last; i++ {
         if i == window.Selection {
             DrawNoteRow(window, i, HighlightPalette)
         } else {
             DrawNoteRow(window, i, DefaultPalette)
         }
     }
+    if window.PreviewVisible() {
+        window.DrawPreviewDivider()
+    }
+    window.DrawScrollIndicator()
+    window.DrawProfile()
+
+    if window.PreviewVisible() {
+        window.Preview.Update(window.SelectedNote())
+        window.Preview.Draw()
+    }
+}
+
+func (window *MainWindow) DrawPreviewDivider() {
+    rowmin, rowmax, _, _ := window.GetTextBounds()
+    _, listmax := window.GetListColumns()
+    col := listmax + 1
+    DrawChar(rowmin-1, col, BOX_DOUBLE_HORIZONTAL_DOWN)
+    DrawChar(rowmax+1, col, BOX_DOUBLE_HORIZONTAL_UP)
+    for r := rowmin; r <= rowmax; r++ {
+        DrawChar(r, col, BOX_DOUBLE_VERTICAL)
+    }
 }
 
 func DisableEcho(fd uintptr) {
@@ -343,9 +619,21 @@ func (label *MultilineTextLabel) Draw() {
 func (inp *TextInput) Draw() {
     y, _, xmin, xmax := inp.GetTextBounds()
     inp.DrawBorders()
-    strlen := len(inp.Value)
-    DrawString(y, xmin, inp.Value)
-    DrawString(y, xmin+strlen, strings.Repeat(" ", xmax-xmin-strlen))
+    DrawString(y, xmin, Pad(inp.VisibleValue(), xmax-xmin))
+}
+
+// VisibleValue returns as much of the end of the value as fits in the input,
+// leaving a column for the cursor after it.
+func (inp *TextInput) VisibleValue() string {
+    _, _, xmin, xmax := inp.GetTextBounds()
+    return tailWidth(inp.Value, xmax-xmin)
+}
+
+// CursorColumn returns the screen column just after the visible value, where
+// the cursor goes while typing.
+func (inp *TextInput) CursorColumn() int {
+    _, _, xmin, _ := inp.GetTextBounds()
+    return xmin + StringWidth(inp.VisibleValue())
 }
 
 func (b *Button) Draw() {
@@ -357,8 +645,8 @@ func (b *Button) Draw() {
     y, _, xmin, xmax := b.GetTextBounds()
     textw := xmax - xmin + 1
     b.DrawBorders()
-    strlen := len(b.Text)
-    buflen := textw - strlen
+    text := Truncate(b.Text, textw)
+    buflen := textw - StringWidth(text)
     var bufleft, bufright int
     if buflen < 0 {
         bufleft, bufright = 0, 0
@@ -369,7 +657,7 @@ func (b *Button) Draw() {
     }
     buftext := fmt.Sprintf("%s%s%s",
         strings.Repeat(" ", bufleft),
-        b.Text,
+        text,
         strings.Repeat(" ", bufright))
     DrawString(y, xmin, buftext)
 }
@@ -0,0 +1,70 @@
+package workflow
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/mrshanahan/notes-api/pkg/notes"
+)
+
+// AppendOptions controls how text is added to the end of a note.
+type AppendOptions struct {
+	// Put a line with the current time between the old & new content
+	Timestamp bool
+	// Used for the timestamp; defaults to time.Now
+	Now func() time.Time
+}
+
+// Append adds data to the end of note's content. It refuses to run while
+// the note is being edited or has an unsaved draft, since uploading the
+// draft later would silently drop the appended text.
+func Append(client NotesClient, note *notes.Note, data []byte, opts AppendOptions) error {
+	release, err := LockNote(note.ID)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	remoteContent, err := client.GetNoteContent(note.ID)
+	if err != nil {
+		return err
+	}
+
+	draftsDir, err := ensureDraftsRoot()
+	if err != nil {
+		return err
+	}
+	draftPath := getDraftPath(draftsDir, getContentHash(remoteContent))
+	if f, err := getIfExists(draftPath); err != nil {
+		return err
+	} else if f != nil {
+		f.Close()
+		return fmt.Errorf("note %d has an unsaved draft at %s; finish or discard it with `notes edit` first", note.ID, draftPath)
+	}
+
+	return client.UpdateNoteContent(note.ID, appendContent(remoteContent, data, opts))
+}
+
+func appendContent(existing []byte, data []byte, opts AppendOptions) []byte {
+	var buf bytes.Buffer
+	buf.Write(existing)
+	if len(existing) > 0 && !bytes.HasSuffix(existing, []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	if opts.Timestamp {
+		now := time.Now
+		if opts.Now != nil {
+			now = opts.Now
+		}
+		if len(existing) > 0 {
+			buf.WriteByte('\n')
+		}
+		fmt.Fprintf(&buf, "--- %s ---\n", now().Format("2006-01-02 15:04:05 MST"))
+	}
+	buf.Write(data)
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
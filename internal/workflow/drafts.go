@@ -0,0 +1,109 @@
+package workflow
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"mrshanahan.com/notes-term/internal/paths"
+)
+
+type LocalCopyResult struct {
+	Path         string
+	IsCancelled  bool
+	OpenReadOnly bool
+}
+
+func ensureDraftsRoot() (string, error) {
+	stateDir, err := paths.EnsureProfileStateFolder()
+	if err != nil {
+		return "", err
+	}
+	draftDir := filepath.Join(stateDir, "drafts")
+	if err = os.MkdirAll(draftDir, 0700); err != nil {
+		return "", err
+	}
+	return draftDir, nil
+}
+
+func createLocalNoteCopy(prompter Prompter, remoteContent []byte) (*LocalCopyResult, error) {
+	draftsDir, err := ensureDraftsRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	// TODO: This is a bit long, maybe truncate
+	hash := getContentHash(remoteContent)
+	path := getDraftPath(draftsDir, hash)
+
+	f, err := getIfExists(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if f != nil {
+		finfo, _ := f.Stat()
+		f.Close()
+		modtime := finfo.ModTime()
+		msg := fmt.Sprintf("An unsaved draft for this note was found locally. Continue editing? (Last edited: %s)", modtime)
+		selection := prompter.RequestOptionSelection(msg, []string{"Edit", "View (read-only)", "Discard", "Cancel"})
+		switch selection {
+		case 0: // Edit
+			return &LocalCopyResult{Path: path}, nil
+		case 1: // View (read-only)
+			return &LocalCopyResult{Path: path, OpenReadOnly: true}, nil
+		case 2: // Discard
+			err = os.Remove(path)
+			if err != nil {
+				return nil, err
+			}
+		case 3, -1: // Cancel
+			return &LocalCopyResult{IsCancelled: true}, nil
+		default:
+			return nil, fmt.Errorf("unexpected option choice for dealing with local copies: %d", selection)
+		}
+	}
+
+	// NB: We should be here if 1) the file did not exist or 2) we discarded it.
+
+	// If file already exists we've done something wrong, so just
+	// we include O_EXCL here to fail fast
+	f, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0660)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	r := bytes.NewReader(remoteContent)
+	_, err = io.Copy(f, r)
+	if err != nil {
+		_ = os.Remove(path)
+		return nil, err
+	}
+
+	return &LocalCopyResult{Path: path}, nil
+}
+
+func getContentHash(content []byte) string {
+	h := sha256.New()
+	h.Write(content)
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+func getDraftPath(root string, hash string) string {
+	name := fmt.Sprintf("note-%s.txt", hash)
+	path := filepath.Join(root, name)
+	return path
+}
+
+func getIfExists(path string) (*os.File, error) {
+	f, err := os.Open(path)
+	if err != nil && os.IsNotExist(err) {
+		return nil, nil
+	}
+	return f, err
+}
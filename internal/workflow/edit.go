@@ -0,0 +1,136 @@
+package workflow
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/mrshanahan/notes-api/pkg/notes"
+	"mrshanahan.com/notes-term/internal/content"
+	"mrshanahan.com/notes-term/internal/editor"
+)
+
+// Prompter asks the user to pick one of several options, returning the index
+// of the chosen option or -1 if they backed out. MainWindow implements this
+// for the TUI & ConsolePrompter for plain stdin/stdout.
+type Prompter interface {
+	RequestOptionSelection(prompt string, options []string) int
+}
+
+// NotesClient is the subset of the API client needed to edit note content.
+type NotesClient interface {
+	GetNote(id int64) (*notes.Note, error)
+	GetNoteContent(id int64) ([]byte, error)
+	UpdateNoteContent(id int64, content []byte) error
+}
+
+// NoteEditor runs the edit cycle for notes: fetch the content, create a local
+// draft, open the draft in the editor & upload the result.
+type NoteEditor struct {
+	Client   NotesClient
+	Editor   *editor.Editor
+	Prompter Prompter
+	// Optional; kept up to date with fetched & uploaded content
+	Cache *content.Cache
+}
+
+// EditResult describes how an edit finished.
+type EditResult struct {
+	Cancelled bool
+	Uploaded  bool
+	// The note as it is after the upload; nil if it couldn't be fetched
+	Note *notes.Note
+	// Something the user should be told, if non-empty
+	Message string
+}
+
+// Edit runs the edit cycle for note. If line is positive the editor is opened
+// at that line. The draft is kept if anything goes wrong after it is created.
+// The note is locked (see LockNote) for the duration.
+func (ne *NoteEditor) Edit(note *notes.Note, line int) (*EditResult, error) {
+	release, err := LockNote(note.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	remoteContent, err := ne.Client.GetNoteContent(note.ID)
+	if err != nil {
+		return nil, err
+	}
+	if ne.Cache != nil {
+		ne.Cache.Put(note, remoteContent)
+	}
+
+	// TODO: This should be a formal cache of some sort, maybe a local DB with the hash + contents
+	result, err := createLocalNoteCopy(ne.Prompter, remoteContent)
+	if err != nil {
+		return nil, fmt.Errorf("error when creating temp file: %w", err)
+	}
+	if result.IsCancelled {
+		return &EditResult{Cancelled: true}, nil
+	}
+
+	path := result.Path
+	if result.OpenReadOnly {
+		modified, err := ne.openReadOnly(path, line)
+		if err != nil {
+			return nil, fmt.Errorf("error opening editor: %w", err)
+		}
+		if modified {
+			return &EditResult{Message: "The draft was modified while open read-only. Changes were kept in the draft but not uploaded."}, nil
+		}
+		return &EditResult{}, nil
+	}
+
+	err = ne.Editor.Run(path, line, false)
+	if err != nil {
+		// Leave the draft in place so nothing typed so far is lost
+		return nil, fmt.Errorf("error opening editor; draft kept at %s: %w", path, err)
+	}
+
+	newContent, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading draft at %s: %w", path, err)
+	}
+	err = ne.Client.UpdateNoteContent(note.ID, newContent)
+	if err != nil {
+		return nil, fmt.Errorf("error uploading; draft kept at %s: %w", path, err)
+	}
+	_ = os.Remove(path)
+
+	// The upload changes the note's UpdatedOn, which the cache is keyed by
+	edited := &EditResult{Uploaded: true}
+	if updated, err := ne.Client.GetNote(note.ID); err == nil {
+		edited.Note = updated
+	}
+	if ne.Cache != nil {
+		if edited.Note != nil {
+			ne.Cache.Put(edited.Note, newContent)
+		} else {
+			ne.Cache.Invalidate(note.ID)
+		}
+	}
+	return edited, nil
+}
+
+// openReadOnly opens path for viewing only: the file's write permissions are
+// dropped for the duration & the editor is passed its read-only flags.
+// Returns true if the file was modified regardless (e.g. by a forced write).
+func (ne *NoteEditor) openReadOnly(path string, line int) (bool, error) {
+	before, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	if err = os.Chmod(path, 0440); err != nil {
+		return false, err
+	}
+	defer os.Chmod(path, 0660)
+
+	err = ne.Editor.Run(path, line, true)
+	after, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return false, readErr
+	}
+	return !bytes.Equal(before, after), err
+}
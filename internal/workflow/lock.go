@@ -0,0 +1,73 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	unix "golang.org/x/sys/unix"
+)
+
+// NoteLockedError is returned when another process is already working on a
+// note's draft.
+type NoteLockedError struct {
+	NoteID int64
+	PID    int
+}
+
+func (e *NoteLockedError) Error() string {
+	return fmt.Sprintf("note %d is open for editing in another process (pid %d); close it first", e.NoteID, e.PID)
+}
+
+// LockNote marks note id as being worked on by this process until the
+// returned release func is called. Locks left behind by processes that have
+// since exited are taken over.
+func LockNote(id int64) (func(), error) {
+	draftsDir, err := ensureDraftsRoot()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(draftsDir, fmt.Sprintf("note-%d.lock", id))
+
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0660)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { _ = os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		pid := readLockOwner(path)
+		if pid > 0 && processAlive(pid) {
+			return nil, &NoteLockedError{id, pid}
+		}
+		// Stale lock; remove it & try again
+		if err = os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("could not lock note %d", id)
+}
+
+func readLockOwner(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+func processAlive(pid int) bool {
+	err := unix.Kill(pid, 0)
+	return err == nil || errors.Is(err, unix.EPERM)
+}
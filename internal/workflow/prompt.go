@@ -0,0 +1,50 @@
+package workflow
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ConsolePrompter asks questions on a plain line-oriented terminal, for use
+// outside of the TUI.
+type ConsolePrompter struct {
+	In  io.Reader
+	Out io.Writer
+
+	reader *bufio.Reader
+}
+
+func NewConsolePrompter(in io.Reader, out io.Writer) *ConsolePrompter {
+	return &ConsolePrompter{In: in, Out: out, reader: bufio.NewReader(in)}
+}
+
+func (p *ConsolePrompter) RequestOptionSelection(prompt string, options []string) int {
+	if p.reader == nil {
+		p.reader = bufio.NewReader(p.In)
+	}
+	if len(options) == 0 {
+		options = []string{"OK"}
+	}
+
+	fmt.Fprintf(p.Out, "%s\n", prompt)
+	for i, o := range options {
+		fmt.Fprintf(p.Out, "  %d) %s\n", i+1, o)
+	}
+	for {
+		fmt.Fprintf(p.Out, "Choice [1-%d]: ", len(options))
+		answer, err := p.reader.ReadString('\n')
+		answer = strings.TrimSpace(answer)
+		if choice, convErr := strconv.Atoi(answer); convErr == nil && choice >= 1 && choice <= len(options) {
+			return choice - 1
+		}
+		if err != nil {
+			// EOF or a broken input; treat as backing out
+			fmt.Fprintln(p.Out)
+			return -1
+		}
+		fmt.Fprintf(p.Out, "Please enter a number between 1 and %d.\n", len(options))
+	}
+}